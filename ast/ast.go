@@ -2,8 +2,10 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"gomonkey/token"
 	"strings"
+	"unicode"
 )
 
 /*  ----------------------------------------------------------- */
@@ -128,6 +130,91 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+/* while (cond) { ... }, the body runs as long as cond is truthy */
+type WhileStatement struct {
+	Token     token.Token // 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	return "while" + ws.Condition.String() + " " + ws.Body.String()
+}
+
+/* for (x in iterable) { ... }, iterates arrays, strings and hash keys */
+type ForStatement struct {
+	Token    token.Token // 'for' token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	return fmt.Sprintf("for (%s in %s) %s",
+		fs.Variable.String(), fs.Iterable.String(), fs.Body.String())
+}
+
+/* Leaves the innermost loop */
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+/* Skips to the next iteration of the innermost loop */
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
+/*
+  import "lib/strings.monkey" as s
+  Binds the module to Alias, its exports are reached with s.name
+*/
+type ImportStatement struct {
+	Token token.Token // 'import' token
+	Path  *StringLiteral
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return "import " + is.Path.String() + " as " + is.Alias.String() + ";"
+}
+
+/* export let name = value; makes name visible to modules importing this one */
+type ExportStatement struct {
+	Token     token.Token // 'export' token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string       { return "export " + es.Statement.String() }
+
+/*
+  Placeholder for a statement the parser could not make sense of.
+  From and To are the first and last tokens skipped while recovering
+*/
+type BadStatement struct {
+	From token.Token
+	To   token.Token
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.From.Literal }
+func (bs *BadStatement) String() string       { return "<bad statement>" }
+
 /*  ----------------------------------------------------------- */
 /*  --- Expressions ------------------------------------------- */
 /*  ----------------------------------------------------------- */
@@ -162,7 +249,7 @@ func (oe *InfixExpression) String() string {
 	return output.String()
 }
 
-/* Integers only, doesn't support floats/doubles */
+/* 64-bit signed integers, String() keeps the source spelling (0xFF, 1_000) */
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
@@ -172,6 +259,51 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+/* 64-bit floats, written with a fraction and/or an exponent (1.5, 2e10) */
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+/* Text between double quotes, Value has the escape sequences decoded */
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return quote(sl.Value) }
+
+/* Inverse of the lexer's escape handling, the result lexes back to s */
+func quote(s string) string {
+	var out bytes.Buffer
+	out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\n':
+			out.WriteString("\\n")
+		case r == '\t':
+			out.WriteString("\\t")
+		case r == '\r':
+			out.WriteString("\\r")
+		case !unicode.IsPrint(r):
+			out.WriteString(fmt.Sprintf("\\u{%x}", r))
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
 /*
    Expressions meant for operators that do not have a left expression
    Eg.  -5, !ok, -count  */
@@ -252,6 +384,32 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+/*
+  macro(a, b) { quote(...) }, the body runs at expansion time on the
+  quoted, unevaluated arguments and must return a quoted AST
+*/
+type MacroLiteral struct {
+	Token      token.Token // 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+	return out.String()
+}
+
 /*
   Function calls
   foo(a, b, c),   bar(a, 5*8+9, z)
@@ -276,3 +434,216 @@ func (ce *CallExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+/*
+  Array literals
+  [1, 2 * 3, fn(x) { x }]
+*/
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+/*
+  Index operator
+  myArray[1], matrix[i][j], getList()[0]
+*/
+type IndexExpression struct {
+	Token token.Token // The '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+/* module.name, access to the exports of an imported module */
+type MemberExpression struct {
+	Token  token.Token // the '.' token
+	Object Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return "(" + me.Object.String() + "." + me.Member.String() + ")"
+}
+
+/*
+  Assignment to an existing binding or to an element of an array or hash.
+  Operator is "=" or a compound operator ("+=", "-=", "*=", "/=").
+  Eg.  x = x + 1,  a[i] = v,  total += n
+*/
+type AssignExpression struct {
+	Token    token.Token // The operator token
+	Target   Expression  // *Identifier or *IndexExpression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Target.String() + " " + ae.Operator + " " + ae.Value.String() + ")"
+}
+
+/*
+  Hash literals, pairs are kept in source order
+  {"name": "Monkey", 1: true, key: value}
+*/
+type HashLiteral struct {
+	Token token.Token // the '{' token
+	Pairs []HashPair
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+/*
+  match (value) { 1 => "one", [a, b] => a + b, _ => "other" }
+  Arms are tried in order, the first pattern that matches picks the result
+*/
+type MatchExpression struct {
+	Token   token.Token // 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+type MatchArm struct {
+	Token   token.Token // the '=>' token
+	Pattern Pattern
+	Body    Expression
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.Pattern.String()+" => "+arm.Body.String())
+	}
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") {")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Patterns ---------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* The left side of a match arm */
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+/* _ matches anything and binds nothing */
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+/* A name matches anything and binds the value to it inside the arm */
+type BindingPattern struct {
+	Name *Identifier
+}
+
+func (bp *BindingPattern) patternNode()         {}
+func (bp *BindingPattern) TokenLiteral() string { return bp.Name.TokenLiteral() }
+func (bp *BindingPattern) String() string       { return bp.Name.String() }
+
+/*
+  Matches values equal to a literal: an integer, float, string or boolean.
+  Negative numbers are a PrefixExpression with a '-' operator
+*/
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Value.TokenLiteral() }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+/* Matches arrays of exactly len(Elements) elements, element by element */
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+/* Matches hashes that have all the keys, other keys are ignored */
+type HashPattern struct {
+	Token token.Token // the '{' token
+	Pairs []HashPatternPair
+}
+
+type HashPatternPair struct {
+	Key   Expression // a literal
+	Value Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
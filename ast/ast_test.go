@@ -25,3 +25,24 @@ func TestString(t *testing.T) {
         t.Errorf("Error: code.String() not working properly [%q]", code.String())
     }
 }
+
+func TestStringLiteralQuoting(t *testing.T) {
+    tests := []struct {
+        value    string
+        expected string
+    }{
+        {"plain", `"plain"`},
+        {`say "hi"`, `"say \"hi\""`},
+        {"a\\b", `"a\\b"`},
+        {"line\nbreak\ttab", `"line\nbreak\ttab"`},
+        {"bell\a", `"bell\u{7}"`},
+        {"café", `"café"`},
+    }
+    for _, tt := range tests {
+        sl := &StringLiteral{Value: tt.value}
+        if sl.String() != tt.expected {
+            t.Errorf("Error: StringLiteral.String() wrong, expected %q [%q]",
+                tt.expected, sl.String())
+        }
+    }
+}
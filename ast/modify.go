@@ -0,0 +1,212 @@
+package ast
+
+/*
+  Called on every node after its children have been modified, the node
+  it returns replaces the original one
+*/
+type ModifierFunc func(Node) Node
+
+/*
+  Walks the tree depth first and builds a new one from the nodes returned
+  by modifier, the original tree is left untouched so a function body can
+  be modified every time the function runs. A child replaced by a node of
+  the wrong kind (eg. a statement where an expression is expected) becomes
+  nil. Names (let names, parameters, loop variables, import aliases and
+  members) are not visited, only expressions, statements and patterns are
+*/
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+
+	// Statements
+	case *Code:
+		code := *node
+		code.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&code)
+
+	case *ExpressionStatement:
+		stmt := *node
+		stmt.Expression = modifyExpression(node.Expression, modifier)
+		return modifier(&stmt)
+
+	case *LetStatement:
+		let := *node
+		let.Value = modifyExpression(node.Value, modifier)
+		return modifier(&let)
+
+	case *ReturnStatement:
+		ret := *node
+		ret.Value = modifyExpression(node.Value, modifier)
+		return modifier(&ret)
+
+	case *BlockStatement:
+		block := *node
+		block.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&block)
+
+	case *WhileStatement:
+		loop := *node
+		loop.Condition = modifyExpression(node.Condition, modifier)
+		loop.Body = modifyBlock(node.Body, modifier)
+		return modifier(&loop)
+
+	case *ForStatement:
+		loop := *node
+		loop.Iterable = modifyExpression(node.Iterable, modifier)
+		loop.Body = modifyBlock(node.Body, modifier)
+		return modifier(&loop)
+
+	case *ExportStatement:
+		export := *node
+		export.Statement, _ = Modify(node.Statement, modifier).(*LetStatement)
+		return modifier(&export)
+
+	// Expressions
+	case *InfixExpression:
+		infix := *node
+		infix.Left = modifyExpression(node.Left, modifier)
+		infix.Right = modifyExpression(node.Right, modifier)
+		return modifier(&infix)
+
+	case *PrefixExpression:
+		prefix := *node
+		prefix.Right = modifyExpression(node.Right, modifier)
+		return modifier(&prefix)
+
+	case *IfExpression:
+		ifExp := *node
+		ifExp.Condition = modifyExpression(node.Condition, modifier)
+		ifExp.Consequence = modifyBlock(node.Consequence, modifier)
+		ifExp.Alternative = modifyBlock(node.Alternative, modifier)
+		return modifier(&ifExp)
+
+	case *FunctionLiteral:
+		fn := *node
+		fn.Body = modifyBlock(node.Body, modifier)
+		return modifier(&fn)
+
+	case *MacroLiteral:
+		macro := *node
+		macro.Body = modifyBlock(node.Body, modifier)
+		return modifier(&macro)
+
+	case *CallExpression:
+		call := *node
+		call.Function = modifyExpression(node.Function, modifier)
+		call.Arguments = modifyExpressions(node.Arguments, modifier)
+		return modifier(&call)
+
+	case *ArrayLiteral:
+		array := *node
+		array.Elements = modifyExpressions(node.Elements, modifier)
+		return modifier(&array)
+
+	case *IndexExpression:
+		index := *node
+		index.Left = modifyExpression(node.Left, modifier)
+		index.Index = modifyExpression(node.Index, modifier)
+		return modifier(&index)
+
+	case *MemberExpression:
+		member := *node
+		member.Object = modifyExpression(node.Object, modifier)
+		return modifier(&member)
+
+	case *AssignExpression:
+		assign := *node
+		assign.Target = modifyExpression(node.Target, modifier)
+		assign.Value = modifyExpression(node.Value, modifier)
+		return modifier(&assign)
+
+	case *HashLiteral:
+		hash := *node
+		hash.Pairs = make([]HashPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			hash.Pairs[i].Key = modifyExpression(pair.Key, modifier)
+			hash.Pairs[i].Value = modifyExpression(pair.Value, modifier)
+		}
+		return modifier(&hash)
+
+	case *MatchExpression:
+		match := *node
+		match.Subject = modifyExpression(node.Subject, modifier)
+		match.Arms = make([]*MatchArm, len(node.Arms))
+		for i, arm := range node.Arms {
+			match.Arms[i] = &MatchArm{
+				Token:   arm.Token,
+				Pattern: modifyPattern(arm.Pattern, modifier),
+				Body:    modifyExpression(arm.Body, modifier),
+			}
+		}
+		return modifier(&match)
+
+	// Patterns
+	case *LiteralPattern:
+		literal := *node
+		literal.Value = modifyExpression(node.Value, modifier)
+		return modifier(&literal)
+
+	case *ArrayPattern:
+		array := *node
+		array.Elements = make([]Pattern, len(node.Elements))
+		for i, element := range node.Elements {
+			array.Elements[i] = modifyPattern(element, modifier)
+		}
+		return modifier(&array)
+
+	case *HashPattern:
+		hash := *node
+		hash.Pairs = make([]HashPatternPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			hash.Pairs[i].Key = modifyExpression(pair.Key, modifier)
+			hash.Pairs[i].Value = modifyPattern(pair.Value, modifier)
+		}
+		return modifier(&hash)
+	}
+
+	// Identifiers, literals, break, continue and bad statements have no
+	// children, they are only handed to modifier
+	return modifier(node)
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) []Statement {
+	modified := make([]Statement, len(statements))
+	for i, statement := range statements {
+		modified[i], _ = Modify(statement, modifier).(Statement)
+	}
+	return modified
+}
+
+func modifyExpressions(exps []Expression, modifier ModifierFunc) []Expression {
+	if exps == nil {
+		return nil
+	}
+	modified := make([]Expression, len(exps))
+	for i, exp := range exps {
+		modified[i] = modifyExpression(exp, modifier)
+	}
+	return modified
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+	modified, _ := Modify(exp, modifier).(Expression)
+	return modified
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	modified, _ := Modify(block, modifier).(*BlockStatement)
+	return modified
+}
+
+func modifyPattern(pattern Pattern, modifier ModifierFunc) Pattern {
+	if pattern == nil {
+		return nil
+	}
+	modified, _ := Modify(pattern, modifier).(Pattern)
+	return modified
+}
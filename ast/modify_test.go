@@ -0,0 +1,123 @@
+package ast
+
+import (
+    "gomonkey/token"
+    "reflect"
+    "testing"
+)
+
+func TestModify(t *testing.T) {
+    one := func() Expression { return &IntegerLiteral{Value: 1} }
+    two := func() Expression { return &IntegerLiteral{Value: 2} }
+    block := func(exp Expression) *BlockStatement {
+        return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: exp}}}
+    }
+
+    turnOneIntoTwo := func(node Node) Node {
+        integer, ok := node.(*IntegerLiteral)
+        if !ok || integer.Value != 1 {
+            return node
+        }
+        integer.Value = 2
+        return integer
+    }
+
+    tests := []struct {
+        input       Node
+        expected    Node
+    }{
+        {one(), two()},
+        {
+            &Code{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+            &Code{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+        },
+        {
+            &InfixExpression{Left: one(), Operator: "+", Right: two()},
+            &InfixExpression{Left: two(), Operator: "+", Right: two()},
+        },
+        {
+            &PrefixExpression{Operator: "-", Right: one()},
+            &PrefixExpression{Operator: "-", Right: two()},
+        },
+        {
+            &IndexExpression{Left: one(), Index: one()},
+            &IndexExpression{Left: two(), Index: two()},
+        },
+        {
+            &IfExpression{Condition: one(), Consequence: block(one()), Alternative: block(one())},
+            &IfExpression{Condition: two(), Consequence: block(two()), Alternative: block(two())},
+        },
+        {&ReturnStatement{Value: one()}, &ReturnStatement{Value: two()}},
+        {&LetStatement{Value: one()}, &LetStatement{Value: two()}},
+        {
+            &FunctionLiteral{Parameters: []*Identifier{}, Body: block(one())},
+            &FunctionLiteral{Parameters: []*Identifier{}, Body: block(two())},
+        },
+        {
+            &MacroLiteral{Parameters: []*Identifier{}, Body: block(one())},
+            &MacroLiteral{Parameters: []*Identifier{}, Body: block(two())},
+        },
+        {
+            &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+            &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+        },
+        {&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+        {
+            &HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}},
+            &HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}}},
+        },
+        {
+            &WhileStatement{Condition: one(), Body: block(one())},
+            &WhileStatement{Condition: two(), Body: block(two())},
+        },
+        {
+            &ForStatement{Variable: &Identifier{Value: "x"}, Iterable: one(), Body: block(one())},
+            &ForStatement{Variable: &Identifier{Value: "x"}, Iterable: two(), Body: block(two())},
+        },
+        {
+            &AssignExpression{Target: &Identifier{Value: "x"}, Operator: "=", Value: one()},
+            &AssignExpression{Target: &Identifier{Value: "x"}, Operator: "=", Value: two()},
+        },
+        {
+            &MatchExpression{Subject: one(), Arms: []*MatchArm{
+                {Pattern: &ArrayPattern{Elements: []Pattern{&LiteralPattern{Value: one()}}}, Body: one()},
+                {Pattern: &HashPattern{Pairs: []HashPatternPair{
+                    {Key: one(), Value: &LiteralPattern{Value: one()}}}}, Body: one()},
+            }},
+            &MatchExpression{Subject: two(), Arms: []*MatchArm{
+                {Pattern: &ArrayPattern{Elements: []Pattern{&LiteralPattern{Value: two()}}}, Body: two()},
+                {Pattern: &HashPattern{Pairs: []HashPatternPair{
+                    {Key: two(), Value: &LiteralPattern{Value: two()}}}}, Body: two()},
+            }},
+        },
+    }
+
+    for i, tt := range tests {
+        modified := Modify(tt.input, turnOneIntoTwo)
+        if !reflect.DeepEqual(modified, tt.expected) {
+            t.Errorf("tests[%d] - not equal. expected=%#v [actual=%#v]", i, tt.expected, modified)
+        }
+    }
+}
+
+/* Only the returned tree changes, the function body can be modified again */
+func TestModifyLeavesOriginalUntouched(t *testing.T) {
+    ident := func(name string) *Identifier {
+        return &Identifier{Token: token.Token{Type: token.IDN, Literal: name}, Value: name}
+    }
+    original := &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")}
+
+    modified := Modify(original, func(node Node) Node {
+        if id, ok := node.(*Identifier); ok && id.Value == "a" {
+            return ident("c")
+        }
+        return node
+    })
+
+    if modified.String() != "(c + b)" {
+        t.Errorf("wrong modified tree [actual=%s]", modified.String())
+    }
+    if original.String() != "(a + b)" {
+        t.Errorf("original tree was changed [actual=%s]", original.String())
+    }
+}
@@ -0,0 +1,78 @@
+package ast
+
+import "gomonkey/token"
+
+/*
+  The position of the token a node was built from, eg. the operator of an
+  infix expression or the 'fn' of a function literal. Zero for nodes that
+  don't keep a token
+*/
+func Pos(node Node) token.Position {
+	switch node := node.(type) {
+
+	// Statements
+	case *Code:
+		if len(node.Statements) > 0 {
+			return Pos(node.Statements[0])
+		}
+	case *ExpressionStatement:
+		return node.Token.Pos
+	case *LetStatement:
+		return node.Token.Pos
+	case *ReturnStatement:
+		return node.Token.Pos
+	case *BlockStatement:
+		return node.Token.Pos
+	case *WhileStatement:
+		return node.Token.Pos
+	case *ForStatement:
+		return node.Token.Pos
+	case *BreakStatement:
+		return node.Token.Pos
+	case *ContinueStatement:
+		return node.Token.Pos
+	case *ImportStatement:
+		return node.Token.Pos
+	case *ExportStatement:
+		return node.Token.Pos
+	case *BadStatement:
+		return node.From.Pos
+
+	// Expressions
+	case *Identifier:
+		return node.Token.Pos
+	case *InfixExpression:
+		return node.Token.Pos
+	case *IntegerLiteral:
+		return node.Token.Pos
+	case *FloatLiteral:
+		return node.Token.Pos
+	case *StringLiteral:
+		return node.Token.Pos
+	case *PrefixExpression:
+		return node.Token.Pos
+	case *Boolean:
+		return node.Token.Pos
+	case *IfExpression:
+		return node.Token.Pos
+	case *FunctionLiteral:
+		return node.Token.Pos
+	case *MacroLiteral:
+		return node.Token.Pos
+	case *CallExpression:
+		return node.Token.Pos
+	case *ArrayLiteral:
+		return node.Token.Pos
+	case *IndexExpression:
+		return node.Token.Pos
+	case *MemberExpression:
+		return node.Token.Pos
+	case *AssignExpression:
+		return node.Token.Pos
+	case *HashLiteral:
+		return node.Token.Pos
+	case *MatchExpression:
+		return node.Token.Pos
+	}
+	return token.Position{}
+}
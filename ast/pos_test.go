@@ -0,0 +1,34 @@
+package ast
+
+import (
+    "gomonkey/token"
+    "testing"
+)
+
+func TestPos(t *testing.T) {
+    at := func(line int, column int) token.Position {
+        return token.Position{Line: line, Column: column}
+    }
+    ident := &Identifier{Token: token.Token{Type: token.IDN, Literal: "x", Pos: at(2, 5)}}
+    infix := &InfixExpression{Token: token.Token{Type: token.PLUS, Literal: "+", Pos: at(2, 7)},
+        Left: ident, Operator: "+", Right: ident}
+    code := &Code{Statements: []Statement{
+        &ExpressionStatement{Token: ident.Token, Expression: infix},
+    }}
+
+    tests := []struct{
+        node        Node
+        expected    token.Position
+    }{
+        {ident, at(2, 5)},
+        {infix, at(2, 7)},
+        {code, at(2, 5)},
+        {&Code{}, token.Position{}},
+        {&BindingPattern{Name: ident}, token.Position{}},
+    }
+    for _, tt := range tests {
+        if pos := Pos(tt.node); pos != tt.expected {
+            t.Errorf("wrong position for %s. expected=%+v [actual=%+v]", tt.node.String(), tt.expected, pos)
+        }
+    }
+}
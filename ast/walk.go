@@ -0,0 +1,197 @@
+package ast
+
+/*
+  Visit is called on every node reached by Walk. If it returns a non-nil
+  visitor w, Walk visits the children of node with w and then calls
+  w.Visit(nil). Returning nil skips the children
+*/
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+/*
+  Traverses the tree depth first, in source order, the same way go/ast does.
+  Unlike Modify every node is visited, including names (let names,
+  parameters, loop variables, import aliases and members). Nil children,
+  eg. a missing else block, are skipped
+*/
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch node := node.(type) {
+
+	// Statements
+	case *Code:
+		walkStatements(v, node.Statements)
+
+	case *ExpressionStatement:
+		walkIfPresent(v, node.Expression)
+
+	case *LetStatement:
+		walkIfPresent(v, node.Name)
+		walkIfPresent(v, node.Value)
+
+	case *ReturnStatement:
+		walkIfPresent(v, node.Value)
+
+	case *BlockStatement:
+		walkStatements(v, node.Statements)
+
+	case *WhileStatement:
+		walkIfPresent(v, node.Condition)
+		walkIfPresent(v, node.Body)
+
+	case *ForStatement:
+		walkIfPresent(v, node.Variable)
+		walkIfPresent(v, node.Iterable)
+		walkIfPresent(v, node.Body)
+
+	case *ImportStatement:
+		walkIfPresent(v, node.Path)
+		walkIfPresent(v, node.Alias)
+
+	case *ExportStatement:
+		walkIfPresent(v, node.Statement)
+
+	// Expressions
+	case *InfixExpression:
+		walkIfPresent(v, node.Left)
+		walkIfPresent(v, node.Right)
+
+	case *PrefixExpression:
+		walkIfPresent(v, node.Right)
+
+	case *IfExpression:
+		walkIfPresent(v, node.Condition)
+		walkIfPresent(v, node.Consequence)
+		walkIfPresent(v, node.Alternative)
+
+	case *FunctionLiteral:
+		walkIdentifiers(v, node.Parameters)
+		walkIfPresent(v, node.Body)
+
+	case *MacroLiteral:
+		walkIdentifiers(v, node.Parameters)
+		walkIfPresent(v, node.Body)
+
+	case *CallExpression:
+		walkIfPresent(v, node.Function)
+		walkExpressions(v, node.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressions(v, node.Elements)
+
+	case *IndexExpression:
+		walkIfPresent(v, node.Left)
+		walkIfPresent(v, node.Index)
+
+	case *MemberExpression:
+		walkIfPresent(v, node.Object)
+		walkIfPresent(v, node.Member)
+
+	case *AssignExpression:
+		walkIfPresent(v, node.Target)
+		walkIfPresent(v, node.Value)
+
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			walkIfPresent(v, pair.Key)
+			walkIfPresent(v, pair.Value)
+		}
+
+	case *MatchExpression:
+		walkIfPresent(v, node.Subject)
+		for _, arm := range node.Arms {
+			walkIfPresent(v, arm.Pattern)
+			walkIfPresent(v, arm.Body)
+		}
+
+	// Patterns
+	case *BindingPattern:
+		walkIfPresent(v, node.Name)
+
+	case *LiteralPattern:
+		walkIfPresent(v, node.Value)
+
+	case *ArrayPattern:
+		for _, element := range node.Elements {
+			walkIfPresent(v, element)
+		}
+
+	case *HashPattern:
+		for _, pair := range node.Pairs {
+			walkIfPresent(v, pair.Key)
+			walkIfPresent(v, pair.Value)
+		}
+	}
+
+	// Identifiers, literals, break, continue, wildcards and bad statements
+	// have no children
+	v.Visit(nil)
+}
+
+/* Adapts a plain function to the Visitor interface, see Inspect */
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+/*
+  Walks the tree calling f on every node, the children of a node are only
+  visited if f returns true. After the children f is called with nil
+*/
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+/*
+  A nil pointer stored in an interface is not == nil, the type switch
+  catches the node types that can be left out by the parser
+*/
+func walkIfPresent(v Visitor, node Node) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *Identifier:
+		if n == nil {
+			return
+		}
+	case *StringLiteral:
+		if n == nil {
+			return
+		}
+	case *BlockStatement:
+		if n == nil {
+			return
+		}
+	case *LetStatement:
+		if n == nil {
+			return
+		}
+	}
+	Walk(v, node)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, statement := range statements {
+		walkIfPresent(v, statement)
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, exp := range exps {
+		walkIfPresent(v, exp)
+	}
+}
+
+func walkIdentifiers(v Visitor, identifiers []*Identifier) {
+	for _, identifier := range identifiers {
+		walkIfPresent(v, identifier)
+	}
+}
@@ -0,0 +1,137 @@
+package ast
+
+import (
+    "reflect"
+    "testing"
+)
+
+/* Identifiers and integers in the order Inspect reaches them */
+func leaves(node Node, descend func(Node) bool) []string {
+    found := []string{}
+    Inspect(node, func(n Node) bool {
+        switch n := n.(type) {
+        case *Identifier:
+            found = append(found, n.Value)
+        case *IntegerLiteral:
+            found = append(found, n.String())
+        }
+        return descend(n)
+    })
+    return found
+}
+
+func TestInspect(t *testing.T) {
+    id := func(name string) *Identifier { return &Identifier{Value: name} }
+    integer := func(value string) *IntegerLiteral {
+        lit := &IntegerLiteral{}
+        lit.Token.Literal = value
+        return lit
+    }
+    block := func(statements ...Statement) *BlockStatement {
+        return &BlockStatement{Statements: statements}
+    }
+    expression := func(exp Expression) Statement { return &ExpressionStatement{Expression: exp} }
+
+    tests := []struct {
+        input       Node
+        expected    []string
+    }{
+        {
+            &Code{Statements: []Statement{
+                &LetStatement{Name: id("add"), Value: &FunctionLiteral{
+                    Parameters: []*Identifier{id("a"), id("b")},
+                    Body: block(&ReturnStatement{Value: &InfixExpression{Left: id("a"), Operator: "+", Right: id("b")}}),
+                }},
+                expression(&IfExpression{Condition: id("x"),
+                    Consequence: block(expression(&CallExpression{Function: id("add"),
+                        Arguments: []Expression{integer("1"), integer("2")}}))}),
+            }},
+            []string{"add", "a", "b", "a", "b", "x", "add", "1", "2"},
+        },
+        {&PrefixExpression{Operator: "-", Right: id("a")}, []string{"a"}},
+        {&MacroLiteral{Parameters: []*Identifier{id("a")}, Body: block(expression(id("b")))}, []string{"a", "b"}},
+        {&ArrayLiteral{Elements: []Expression{integer("1"), id("a")}}, []string{"1", "a"}},
+        {&IndexExpression{Left: id("a"), Index: integer("0")}, []string{"a", "0"}},
+        {&MemberExpression{Object: id("m"), Member: id("f")}, []string{"m", "f"}},
+        {&AssignExpression{Target: id("a"), Operator: "+=", Value: integer("1")}, []string{"a", "1"}},
+        {&HashLiteral{Pairs: []HashPair{{Key: id("k"), Value: id("v")}}}, []string{"k", "v"}},
+        {&WhileStatement{Condition: id("c"), Body: block(&BreakStatement{})}, []string{"c"}},
+        {&ForStatement{Variable: id("x"), Iterable: id("xs"), Body: block(&ContinueStatement{})}, []string{"x", "xs"}},
+        {&ImportStatement{Path: &StringLiteral{Value: "m"}, Alias: id("m")}, []string{"m"}},
+        {&ExportStatement{Statement: &LetStatement{Name: id("a"), Value: integer("1")}}, []string{"a", "1"}},
+        {
+            &MatchExpression{Subject: id("s"), Arms: []*MatchArm{
+                {Pattern: &LiteralPattern{Value: integer("1")}, Body: id("one")},
+                {Pattern: &ArrayPattern{Elements: []Pattern{&BindingPattern{Name: id("a")}, &WildcardPattern{}}}, Body: id("a")},
+                {Pattern: &HashPattern{Pairs: []HashPatternPair{{Key: id("k"), Value: &BindingPattern{Name: id("v")}}}}, Body: id("v")},
+            }},
+            []string{"s", "1", "one", "a", "a", "k", "v", "v"},
+        },
+        // missing children are skipped
+        {&IfExpression{Condition: id("c"), Consequence: block()}, []string{"c"}},
+        {&ReturnStatement{}, []string{}},
+        {&ExpressionStatement{}, []string{}},
+    }
+
+    everything := func(Node) bool { return true }
+    for _, tt := range tests {
+        actual := leaves(tt.input, everything)
+        if !reflect.DeepEqual(actual, tt.expected) {
+            t.Errorf("wrong nodes for %s. expected=%v [actual=%v]", tt.input, tt.expected, actual)
+        }
+    }
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+    fn := &FunctionLiteral{
+        Parameters: []*Identifier{{Value: "a"}},
+        Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &Identifier{Value: "a"}}}},
+    }
+    code := &Code{Statements: []Statement{
+        &ExpressionStatement{Expression: fn},
+        &ExpressionStatement{Expression: &Identifier{Value: "b"}},
+    }}
+
+    actual := leaves(code, func(n Node) bool {
+        _, isFunction := n.(*FunctionLiteral)
+        return !isFunction
+    })
+    if !reflect.DeepEqual(actual, []string{"b"}) {
+        t.Errorf("function body should be skipped [actual=%v]", actual)
+    }
+}
+
+/* Counts how deep Walk is, every Visit(node) must be paired with a Visit(nil) */
+type depthVisitor struct {
+    depth   *int
+    max     *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+    if node == nil {
+        *v.depth -= 1
+        return nil
+    }
+    *v.depth += 1
+    if *v.depth > *v.max {
+        *v.max = *v.depth
+    }
+    return v
+}
+
+func TestWalkPairsVisits(t *testing.T) {
+    depth, max := 0, 0
+    node := &ExpressionStatement{Expression: &InfixExpression{
+        Left:       &Identifier{Value: "a"},
+        Operator:   "*",
+        Right:      &PrefixExpression{Operator: "-", Right: &Identifier{Value: "b"}},
+    }}
+    Walk(depthVisitor{&depth, &max}, node)
+
+    if depth != 0 {
+        t.Errorf("unbalanced Visit calls [depth=%d]", depth)
+    }
+    if max != 4 {
+        t.Errorf("wrong maximum depth. expected=4 [actual=%d]", max)
+    }
+}
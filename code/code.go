@@ -0,0 +1,269 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+  Bytecode is a flat sequence of instructions. An instruction is a one
+  byte opcode followed by its operands, encoded big endian with the widths
+  given by the opcode's Definition
+*/
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constants[i]
+	OpPop                    // discard the top of the stack
+
+	// Operators, they pop their operands and push the result
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShl
+	OpShr
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpLessEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpMinus
+	OpBang
+	OpBitNot
+
+	OpTrue
+	OpFalse
+	OpNull
+	OpDup // push the top of the stack again
+
+	// Jumps take an absolute offset into the instructions
+	OpJump
+	OpJumpNotTruthy // pops the condition
+
+	// Bindings
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpSetFree
+	OpGetBuiltin
+
+	// Data structures
+	OpArray    // pops n elements
+	OpHash     // pops n keys and values, n is twice the number of pairs
+	OpIndex    // pops the container and the index
+	OpSetIndex // pops container, index and value, pushes the value. The operand is the operator of a compound assignment, 0 for '='
+	OpMember   // pops a module, pushes the export named constants[i]
+
+	// Functions
+	OpCall        // the callee is below its n arguments
+	OpReturnValue // return the top of the stack
+	OpReturn      // return without a value
+	OpClosure     // wrap the function constants[i] in a closure
+
+	// for (x in iterable) loops
+	OpIter     // pops an array, string or hash, pushes an iterator over it
+	OpIterNext // pushes the next item and true, or only false when done
+
+	// Match patterns, they push true or false
+	OpMatchArray // pops a value, is it an array with n elements
+	OpMatchHash  // pops a value, is it a hash
+	OpMatchKey   // pops a hash and a key, does the hash have the key
+	OpMatchEqual // pops two values, are they equal. Unlike OpEqual this never fails
+
+	OpQuote  // quote constants[i], splicing in the n values on the stack
+	OpImport // push the module at path constants[i]
+
+	// break and continue inside an expression leave its operands behind
+	OpLoop   // push the marker a while loop keeps on the stack, like a for loop's iterator
+	OpUnwind // pop everything above the marker or iterator of the innermost loop
+
+	OpAssignGlobal // like OpSetGlobal for an assignment, fails while no let has bound the global
+)
+
+/* Name and operand widths in bytes, used to encode and decode an opcode */
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShl:          {"OpShl", []int{}},
+	OpShr:          {"OpShr", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	OpBitNot:       {"OpBitNot", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+	OpDup:   {"OpDup", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:  {"OpGetGlobal", []int{2}},
+	OpSetGlobal:  {"OpSetGlobal", []int{2}},
+	OpGetLocal:   {"OpGetLocal", []int{1}},
+	OpSetLocal:   {"OpSetLocal", []int{1}},
+	OpGetFree:    {"OpGetFree", []int{1}},
+	OpSetFree:    {"OpSetFree", []int{1}},
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{1}},
+	OpMember:   {"OpMember", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{}},
+
+	OpMatchArray: {"OpMatchArray", []int{2}},
+	OpMatchHash:  {"OpMatchHash", []int{}},
+	OpMatchKey:   {"OpMatchKey", []int{}},
+	OpMatchEqual: {"OpMatchEqual", []int{}},
+
+	OpQuote:  {"OpQuote", []int{2, 1}},
+	OpImport: {"OpImport", []int{2}},
+
+	OpLoop:   {"OpLoop", []int{}},
+	OpUnwind: {"OpUnwind", []int{}},
+
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+/* Encodes one instruction, an unknown opcode gives an empty one */
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+/* Decodes the operands following an opcode, returns them and their total width */
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+/* One instruction per line, prefixed with its offset: "0003 OpConstant 1" */
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, FormatInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+/* The opcode name followed by the operands, eg. "OpConstant 1" */
+func FormatInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
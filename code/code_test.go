@@ -0,0 +1,122 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpQuote, []int{65534, 255}, []byte{byte(OpQuote), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. expected=%d [actual=%d]",
+				len(tt.expected), len(instruction))
+			continue
+		}
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. expected=%d [actual=%d]", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpQuote, 3, 2),
+	}
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpQuote 3 2
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nexpected=%q\n[actual=%q]",
+			expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpQuote, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. expected=%d [actual=%d]", tt.bytesRead, n)
+		}
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. expected=%d [actual=%d]", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+/* Every opcode must have a definition, or it can't be encoded */
+func TestDefinitions(t *testing.T) {
+	for op := OpConstant; op <= OpImport; op++ {
+		if _, err := Lookup(byte(op)); err != nil {
+			t.Errorf("opcode %d has no definition", op)
+		}
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	var lines LineTable
+	lines = lines.Add(0, 1)
+	lines = lines.Add(3, 1)
+	lines = lines.Add(4, 2)
+	lines = lines.Add(7, 5)
+	lines = lines.Add(7, 3)
+
+	if len(lines) != 3 {
+		t.Errorf("wrong number of entries. expected=3 [actual=%d]", len(lines))
+	}
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1}, {3, 1}, {4, 2}, {6, 2}, {7, 3}, {100, 3},
+	}
+	for _, tt := range tests {
+		if line := lines.Line(tt.offset); line != tt.expected {
+			t.Errorf("wrong line for offset %d. expected=%d [actual=%d]", tt.offset, tt.expected, line)
+		}
+	}
+	if line := (LineTable{}).Line(0); line != 0 {
+		t.Errorf("empty table should give line 0 [actual=%d]", line)
+	}
+}
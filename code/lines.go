@@ -0,0 +1,36 @@
+package code
+
+import "sort"
+
+/*
+  Maps instructions back to the source lines they were compiled from.
+  There is an entry for each instruction that starts a new line, sorted
+  by offset, so the entry of an instruction is the last one at or before it
+*/
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+/* Records that the instruction at offset comes from line */
+func (t LineTable) Add(offset int, line int) LineTable {
+	if len(t) > 0 && t[len(t)-1].Line == line {
+		return t
+	}
+	if len(t) > 0 && t[len(t)-1].Offset == offset {
+		t[len(t)-1].Line = line
+		return t
+	}
+	return append(t, LineEntry{Offset: offset, Line: line})
+}
+
+/* The line of the instruction at offset, 0 when it is unknown */
+func (t LineTable) Line(offset int) int {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return t[i-1].Line
+}
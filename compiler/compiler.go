@@ -0,0 +1,974 @@
+package compiler
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/code"
+	"gomonkey/object"
+	"sort"
+	"strings"
+)
+
+/*
+  Lowers the AST to bytecode for the VM. The bytecode must behave exactly
+  like the evaluator does on the same tree, so scoping follows its rules:
+  functions and match arms open a scope, blocks and loops don't, and a
+  name is looked up where it is used, not where it is defined. To get that
+  with slots every name bound anywhere in a scope is declared before the
+  scope is compiled. A slot read before its 'let' ran is empty, or stands
+  for the outer variable of the same name
+*/
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	line int // source line of the node being compiled
+
+	// The first operand that did not fit its width, Compile returns it
+	overflow error
+}
+
+/* The instructions of the function (or top level) being compiled */
+type CompilationScope struct {
+	instructions    code.Instructions
+	lines           code.LineTable
+	lastInstruction EmittedInstruction
+	loops           []*loopLabels
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+/* Jump targets of the innermost loop, breaks are patched when it ends */
+type loopLabels struct {
+	continueTarget int
+	breaks         []int
+}
+
+/*
+  The output of the compiler. GlobalNames holds the name of each global
+  slot so the VM can report the name of a global that has no value yet,
+  Lines maps the top level instructions to source lines
+*/
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	GlobalNames  []string
+	Lines        code.LineTable
+}
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+	return NewWithState(symbolTable, []object.Object{})
+}
+
+/*
+  Keeps compiling against the globals and constants of earlier code, the
+  REPL uses it so each line sees the bindings made by the previous ones
+*/
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.Global().Names(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+	}
+}
+
+/*
+  Compiles a whole program. The top level is compiled like the body of a
+  function: it returns the value of its last statement, or no value when
+  that is a let, import or export
+*/
+func (c *Compiler) Compile(node ast.Node) error {
+	code, ok := node.(*ast.Code)
+	if !ok {
+		return fmt.Errorf("expected *ast.Code, got %T", node)
+	}
+	c.declare(code)
+	if err := c.compileBody(code.Statements); err != nil {
+		return err
+	}
+	return c.overflow
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Statements -------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* Statements of a function or of the top level, ends with a return */
+func (c *Compiler) compileBody(statements []ast.Statement) error {
+	hasValue, err := c.compileStatements(statements, true)
+	if err != nil {
+		return err
+	}
+	if hasValue {
+		c.emit(code.OpReturnValue)
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+	return nil
+}
+
+/*
+  With keepValue the value of the last statement is left on the stack, if
+  it has one: an expression does, a loop gives null. Returns whether a
+  value was left
+*/
+func (c *Compiler) compileStatements(statements []ast.Statement, keepValue bool) (bool, error) {
+	for i, statement := range statements {
+		last := keepValue && i == len(statements)-1
+
+		if err := c.compileStatement(statement); err != nil {
+			return false, err
+		}
+		switch statement.(type) {
+		case *ast.ExpressionStatement:
+			if last {
+				return true, nil
+			}
+			c.emit(code.OpPop)
+		case *ast.WhileStatement, *ast.ForStatement:
+			if last {
+				c.emit(code.OpNull)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+/* Expression statements leave their value on the stack */
+func (c *Compiler) compileStatement(statement ast.Statement) error {
+	defer c.setLine(statement)()
+
+	switch node := statement.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			c.emit(code.OpNull)
+			return nil
+		}
+		return c.compileExpression(node.Expression)
+
+	case *ast.LetStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.ExportStatement:
+		return c.compileStatement(node.Statement)
+
+	case *ast.ReturnStatement:
+		if node.Value == nil {
+			c.emit(code.OpReturn)
+			return nil
+		}
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("break outside of a loop")
+		}
+		c.emit(code.OpUnwind)
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("continue outside of a loop")
+		}
+		c.emit(code.OpUnwind)
+		c.emit(code.OpJump, loop.continueTarget)
+
+	case *ast.ImportStatement:
+		symbol := c.symbolTable.Define(node.Alias.Value)
+		c.emit(code.OpImport, c.addConstant(&object.String{Value: node.Path.Value}))
+		c.storeSymbol(symbol)
+
+	default:
+		return fmt.Errorf("unsupported statement: %T", statement)
+	}
+	return nil
+}
+
+/* The loop marker stays on the stack while the loop runs */
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	c.emit(code.OpLoop)
+	start := len(c.currentInstructions())
+	if err := c.compileExpression(node.Condition); err != nil {
+		return err
+	}
+	exit := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileLoopBody(node.Body, start); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	c.changeOperand(exit, len(c.currentInstructions()))
+	c.endLoop()
+	c.emit(code.OpPop)
+	return nil
+}
+
+/* The iterator stays on the stack while the loop runs */
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.compileExpression(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	next := c.emit(code.OpIterNext)
+	exit := c.emit(code.OpJumpNotTruthy, 9999)
+	c.storeSymbol(c.symbolTable.Define(node.Variable.Value))
+
+	if err := c.compileLoopBody(node.Body, next); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, next)
+
+	c.changeOperand(exit, len(c.currentInstructions()))
+	c.endLoop()
+	c.emit(code.OpPop)
+	return nil
+}
+
+/* Starts a loop, the caller ends it with endLoop once the exit is known */
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, continueTarget int) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loopLabels{continueTarget: continueTarget})
+	_, err := c.compileStatements(body.Statements, false)
+	return err
+}
+
+/* Points the breaks of the innermost loop at the current position */
+func (c *Compiler) endLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) currentLoop() *loopLabels {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Expressions ------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShl,
+	">>": code.OpShr,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"!": code.OpBang,
+	"~": code.OpBitNot,
+}
+
+func (c *Compiler) compileExpression(exp ast.Expression) error {
+	defer c.setLine(exp)()
+
+	switch node := exp.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// not bound anywhere yet, it may be by the time the code runs
+			symbol = c.symbolTable.Global().Define(node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.PrefixExpression:
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator: %s", node.Operator)
+		}
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator: %s", node.Operator)
+		}
+		if err := c.compileExpression(node.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macros can only be defined by a top level let statement")
+
+	case *ast.CallExpression:
+		if isCallTo(node, "quote") {
+			return c.compileQuote(node)
+		}
+		if len(node.Arguments) > 255 {
+			return fmt.Errorf("too many arguments: %d", len(node.Arguments))
+		}
+		if err := c.compileExpression(node.Function); err != nil {
+			return err
+		}
+		if err := c.compileExpressions(node.Arguments); err != nil {
+			return err
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.compileExpressions([]ast.Expression{pair.Key, pair.Value}); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.compileExpressions([]ast.Expression{node.Left, node.Index}); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.MemberExpression:
+		if err := c.compileExpression(node.Object); err != nil {
+			return err
+		}
+		c.emit(code.OpMember, c.addConstant(&object.String{Value: node.Member.Value}))
+
+	default:
+		return fmt.Errorf("unsupported expression: %T", exp)
+	}
+	return nil
+}
+
+func (c *Compiler) compileExpressions(exps []ast.Expression) error {
+	for _, exp := range exps {
+		if err := c.compileExpression(exp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* The right side only runs when needed, the result is always a boolean */
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.compileExpression(node.Left); err != nil {
+		return err
+	}
+	toFalse := []int{}
+	toEnd := []int{}
+
+	if node.Operator == "&&" {
+		toFalse = append(toFalse, c.emit(code.OpJumpNotTruthy, 9999))
+	} else {
+		toRight := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		toEnd = append(toEnd, c.emit(code.OpJump, 9999))
+		c.changeOperand(toRight, len(c.currentInstructions()))
+	}
+
+	if err := c.compileExpression(node.Right); err != nil {
+		return err
+	}
+	toFalse = append(toFalse, c.emit(code.OpJumpNotTruthy, 9999))
+	c.emit(code.OpTrue)
+	toEnd = append(toEnd, c.emit(code.OpJump, 9999))
+
+	for _, jump := range toFalse {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	c.emit(code.OpFalse)
+	for _, jump := range toEnd {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+/* Leaves the assigned value on the stack */
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	var op code.Opcode
+	if node.Operator != "=" {
+		var ok bool
+		op, ok = infixOperators[strings.TrimSuffix(node.Operator, "=")]
+		if !ok {
+			return fmt.Errorf("unknown operator: %s", node.Operator)
+		}
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok || symbol.Scope == BuiltinScope {
+			// a let may bind it before the assignment runs, until then
+			// the VM fails like the evaluator
+			symbol = c.symbolTable.Global().Define(target.Value)
+		}
+		if node.Operator != "=" {
+			c.loadSymbol(symbol)
+		}
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		if node.Operator != "=" {
+			c.emit(op)
+		}
+		c.emit(code.OpDup)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpAssignGlobal, symbol.Index)
+		} else {
+			c.storeSymbol(symbol)
+		}
+
+	case *ast.IndexExpression:
+		if err := c.compileExpressions([]ast.Expression{target.Left, target.Index, node.Value}); err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex, int(op))
+
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.compileExpression(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+/* A block used as a value, null when its last statement has none */
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	hasValue, err := c.compileStatements(block.Statements, true)
+	if err != nil {
+		return err
+	}
+	if !hasValue {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+/*
+  The subject is kept in a hidden slot. Each arm is a scope of its own,
+  its pattern is a series of tests that jump to the next arm on failure
+  and bindings that store parts of the subject
+*/
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.compileExpression(node.Subject); err != nil {
+		return err
+	}
+	c.enterBlock()
+	defer c.leaveBlock()
+	subject := c.symbolTable.Define("match subject")
+	c.storeSymbol(subject)
+	load := func() error {
+		c.loadSymbol(subject)
+		return nil
+	}
+
+	done := []int{}
+	for _, arm := range node.Arms {
+		c.enterBlock()
+		c.declare(arm.Body)
+
+		fails := []int{}
+		if err := c.compilePattern(arm.Pattern, load, &fails); err != nil {
+			return err
+		}
+		if err := c.compileExpression(arm.Body); err != nil {
+			return err
+		}
+		done = append(done, c.emit(code.OpJump, 9999))
+
+		for _, fail := range fails {
+			c.changeOperand(fail, len(c.currentInstructions()))
+		}
+		c.leaveBlock()
+	}
+	c.emit(code.OpNull)
+
+	for _, jump := range done {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+/* load pushes the value the pattern is matched against */
+func (c *Compiler) compilePattern(pattern ast.Pattern, load func() error, fails *[]int) error {
+	test := func() {
+		*fails = append(*fails, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+
+	case *ast.BindingPattern:
+		symbol := c.symbolTable.Define(pattern.Name.Value)
+		if err := load(); err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.LiteralPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		if err := c.compileExpression(pattern.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpMatchEqual)
+		test()
+
+	case *ast.ArrayPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		c.emit(code.OpMatchArray, len(pattern.Elements))
+		test()
+		for i, element := range pattern.Elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			loadElement := func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+				return nil
+			}
+			if err := c.compilePattern(element, loadElement, fails); err != nil {
+				return err
+			}
+		}
+
+	case *ast.HashPattern:
+		if err := load(); err != nil {
+			return err
+		}
+		c.emit(code.OpMatchHash)
+		test()
+		for _, pair := range pattern.Pairs {
+			key := pair.Key
+			loadKey := func() error {
+				if err := load(); err != nil {
+					return err
+				}
+				return c.compileExpression(key)
+			}
+			if err := loadKey(); err != nil {
+				return err
+			}
+			c.emit(code.OpMatchKey)
+			test()
+
+			loadValue := func() error {
+				if err := loadKey(); err != nil {
+					return err
+				}
+				c.emit(code.OpIndex)
+				return nil
+			}
+			if err := c.compilePattern(pair.Value, loadValue, fails); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unsupported pattern: %T", pattern)
+	}
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+	for i, param := range node.Parameters {
+		if hiddenParameter(node.Parameters, i) {
+			// like in the evaluator the last one of the name is bound
+			c.symbolTable.DefineHidden(param.Value)
+		} else {
+			c.symbolTable.Define(param.Value)
+		}
+	}
+	c.declare(node.Body)
+
+	if err := c.compileBody(node.Body.Statements); err != nil {
+		c.leaveScope()
+		return err
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	shadows := c.symbolTable.Shadows
+	numLocals := c.symbolTable.NumDefinitions()
+	locals := c.symbolTable.Names()
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+
+	if numLocals > 256 || len(freeSymbols) > 256 {
+		return fmt.Errorf("too many variables in function: %d locals, %d free",
+			numLocals, len(freeSymbols))
+	}
+
+	captures := make([]object.Capture, len(freeSymbols))
+	for i, s := range freeSymbols {
+		captures[i] = object.Capture{Local: s.Scope == LocalScope, Index: s.Index, Name: s.Name}
+	}
+	fallbacks := make([]object.Fallback, len(shadows))
+	for i, s := range shadows {
+		fallbacks[i] = object.Fallback{Local: s.Index, Scope: string(s.Outer.Scope), Index: s.Outer.Index}
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Locals:        locals,
+		Captures:      captures,
+		Fallbacks:     fallbacks,
+		Body:          node.Body.String(),
+		Lines:         lines,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+/*
+  quote(exp) becomes a constant holding exp. The arguments of the
+  unquote(...) calls in it are compiled in source order, the VM splices
+  their values in. An unquote nested in another makes the quote fail when
+  it runs, like in the evaluator, none of them are compiled then
+*/
+func (c *Compiler) compileQuote(node *ast.CallExpression) error {
+	if len(node.Arguments) != 1 {
+		return fmt.Errorf("wrong number of arguments: expected 1, got %d", len(node.Arguments))
+	}
+
+	unquoted := []ast.Expression{}
+	nested := false
+	var err error
+	ast.Inspect(node.Arguments[0], func(n ast.Node) bool {
+		if err != nil || !isCallTo(n, "unquote") {
+			return err == nil
+		}
+		call := n.(*ast.CallExpression)
+		if len(call.Arguments) != 1 {
+			err = fmt.Errorf("wrong number of arguments: expected 1, got %d", len(call.Arguments))
+			return false
+		}
+		unquoted = append(unquoted, call.Arguments[0])
+		ast.Inspect(call.Arguments[0], func(n ast.Node) bool {
+			nested = nested || isCallTo(n, "unquote")
+			return !nested
+		})
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if len(unquoted) > 255 {
+		return fmt.Errorf("too many unquote calls: %d", len(unquoted))
+	}
+
+	if nested {
+		unquoted = nil
+	}
+	if err := c.compileExpressions(unquoted); err != nil {
+		return err
+	}
+	c.emit(code.OpQuote, c.addConstant(&object.Quote{Node: node.Arguments[0]}), len(unquoted))
+	return nil
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Scopes ------------------------------------------------ */
+/*  ----------------------------------------------------------- */
+
+/*
+  Defines every name bound in node: by let, for, import, in blocks and
+  loops too, but not inside functions or match arms which are scopes of
+  their own
+*/
+func (c *Compiler) declare(node ast.Node) {
+	names := map[string]bool{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			names[n.Name.Value] = true
+		case *ast.ForStatement:
+			names[n.Variable.Value] = true
+		case *ast.ImportStatement:
+			names[n.Alias.Value] = true
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.MatchExpression:
+			c.declare(n.Subject)
+			return false
+		}
+		return true
+	})
+
+	// sorted so the slots don't depend on map order
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		c.symbolTable.DefineShadowing(name)
+	}
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
+
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+/* Pops the top of the stack into the symbol's slot */
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Emitting ---------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+/* Appends an instruction and returns its position */
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.setLastInstruction(op, pos)
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = append(scope.instructions, ins...)
+	if c.line > 0 {
+		scope.lines = scope.lines.Add(posNewInstruction, c.line)
+	}
+	return posNewInstruction
+}
+
+/*
+  Makes node's line the current one and returns a function that restores
+  the previous line, meant for 'defer c.setLine(node)()'
+*/
+func (c *Compiler) setLine(node ast.Node) func() {
+	previous := c.line
+	if line := ast.Pos(node).Line; line > 0 {
+		c.line = line
+	}
+	return func() { c.line = previous }
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	c.scopes[c.scopeIndex].lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+/* Rewrites the operand of a jump emitted before its target was known */
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+	newInstruction := code.Make(op, operand)
+	copy(c.currentInstructions()[opPos:], newInstruction)
+}
+
+/*
+  code.Make truncates operands that are too wide for their opcode, which
+  would silently run the wrong code. Constant indexes, element counts and
+  jump targets all go up to 65535
+*/
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.overflow != nil {
+		return
+	}
+	for i, width := range def.OperandWidths {
+		max := 1<<(8*width) - 1
+		if i < len(operands) && operands[i] > max {
+			c.overflow = fmt.Errorf("program too large: %s operand %d exceeds %d",
+				def.Name, operands[i], max)
+			return
+		}
+	}
+}
+
+/* Whether a later parameter has the same name as parameters[i] */
+func hiddenParameter(parameters []*ast.Identifier, i int) bool {
+	for _, later := range parameters[i+1:] {
+		if later.Value == parameters[i].Value {
+			return true
+		}
+	}
+	return false
+}
+
+func isCallTo(node ast.Node, name string) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
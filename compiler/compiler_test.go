@@ -0,0 +1,407 @@
+package compiler
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/code"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "-1; !true",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             `[1, "a"][0]`,
+			expectedConstants: []interface{}{1, "a", 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "if (true) { 10 }",
+			expectedConstants: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 12),
+				code.Make(code.OpFalse),
+				code.Make(code.OpJumpNotTruthy, 12),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpFalse),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBindings(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// names are declared before the code runs, so the use of y
+			// refers to the slot its let fills later
+			input:             "let x = 1; let y = x; y += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpDup),
+				code.Make(code.OpAssignGlobal, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// a let may still bind y or len, the VM checks when it runs
+			input:             "y = 1; len = 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup),
+				code.Make(code.OpAssignGlobal, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "len([]); let a = 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			input:             "for (x in [1]) { x }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpIter),
+				code.Make(code.OpIterNext),
+				code.Make(code.OpJumpNotTruthy, 21),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 7),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+/* break and continue unwind the stack down to the marker or iterator of their loop */
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpLoop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 12),
+				code.Make(code.OpUnwind),
+				code.Make(code.OpJump, 12),
+				code.Make(code.OpJump, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "for (x in []) { [x, if (x) { continue } else { 1 }] }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpIter),
+				code.Make(code.OpIterNext),
+				code.Make(code.OpJumpNotTruthy, 38),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpNotTruthy, 28),
+				code.Make(code.OpUnwind),
+				code.Make(code.OpJump, 4),
+				code.Make(code.OpNull),
+				code.Make(code.OpJump, 31),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 4),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	fn := compileConstant(t, "fn(a) { fn(b) { a + b } }", 0)
+	if len(fn.Captures) != 1 || fn.Captures[0] != (object.Capture{Local: true, Index: 0, Name: "a"}) {
+		t.Errorf("wrong captures [actual=%+v]", fn.Captures)
+	}
+
+	// until its let runs, the local x is the x of the enclosing function
+	fn = compileConstant(t, "fn(x) { fn() { let x = x + 1; x } }", 1)
+	expected := object.Fallback{Local: 0, Scope: "FREE", Index: 0}
+	if len(fn.Fallbacks) != 1 || fn.Fallbacks[0] != expected {
+		t.Errorf("wrong fallbacks. expected=%+v [actual=%+v]", expected, fn.Fallbacks)
+	}
+
+	// the last parameter of a name is the one bound to it
+	fn = compileConstant(t, "fn(a, a) { a }", 0)
+	ins := concatInstructions([]code.Instructions{code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue)})
+	if fn.NumLocals != 2 || fn.Instructions.String() != ins.String() {
+		t.Errorf("wrong function [actual=%d locals, %q]", fn.NumLocals, fn.Instructions.String())
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { macro(x) { x } }", "macros can only be defined by a top level let statement"},
+	}
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. expected=%q [actual=%q]", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+/* Operands wider than their opcode allows are an error, not wrong code */
+func TestOperandLimits(t *testing.T) {
+	elements := func(n int, element func(i int) string) string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = element(i)
+		}
+		return strings.Join(list, ", ")
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let a = [" + elements(70000, strconv.Itoa) + "]; a[65536]",
+			"program too large: OpConstant operand 65536 exceeds 65535",
+		},
+		{
+			"[" + elements(65536, func(int) string { return "x" }) + "]",
+			"program too large: OpArray operand 65536 exceeds 65535",
+		},
+		{
+			"{" + elements(32768, func(int) string { return "true: 1" }) + "}",
+			"program too large: OpHash operand 65536 exceeds 65535",
+		},
+		{
+			"if (true) { [" + elements(22000, func(int) string { return "x" }) + "]; 1 }",
+			"program too large: OpJumpNotTruthy operand 66020 exceeds 65535",
+		},
+	}
+	for _, tt := range tests {
+		err := New().Compile(parse("let x = 1; " + tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q [actual=%v]", tt.expected, err)
+		}
+	}
+
+	// the limit is the same when the REPL keeps adding to the constants
+	constants := make([]object.Object, 65536)
+	err := NewWithState(New().symbolTable, constants).Compile(parse("1"))
+	expected := "program too large: OpConstant operand 65536 exceeds 65535"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q [actual=%v]", expected, err)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error for %s: %s", tt.input, err)
+		}
+		bytecode := compiler.Bytecode()
+		testInstructions(t, tt.input, tt.expectedInstructions, bytecode.Instructions)
+		testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func parse(input string) *ast.Code {
+	return parser.New(lexer.New(input)).ParseCode()
+}
+
+func compileConstant(t *testing.T, input string, index int) *object.CompiledFunction {
+	t.Helper()
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error for %s: %s", input, err)
+	}
+	return compiler.Bytecode().Constants[index].(*object.CompiledFunction)
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+	concatted := concatInstructions(expected)
+	if actual.String() != concatted.String() {
+		t.Errorf("wrong instructions for %s.\nexpected=%q\n[actual=%q]",
+			input, concatted.String(), actual.String())
+	}
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Errorf("wrong number of constants for %s. expected=%d [actual=%d]",
+			input, len(expected), len(actual))
+		return
+	}
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("wrong constant %d. expected=%d [actual=%s]", i, constant, actual[i].Inspect())
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				t.Errorf("wrong constant %d. expected=%q [actual=%s]", i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("constant %d is not a function [actual=%T]", i, actual[i])
+				continue
+			}
+			testInstructions(t, input, constant, fn.Instructions)
+		}
+	}
+}
+
+func TestLineTables(t *testing.T) {
+	input := "let a = 1;\nlet f = fn(x) {\n  x +\n    a\n};\nf(2)"
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	// OpConstant 1, OpSetGlobal, OpClosure, OpSetGlobal, OpGetGlobal ...
+	expected := code.LineTable{{Offset: 0, Line: 1}, {Offset: 6, Line: 2}, {Offset: 12, Line: 6}}
+	if fmt.Sprint(bytecode.Lines) != fmt.Sprint(expected) {
+		t.Errorf("wrong top level lines. expected=%v [actual=%v]", expected, bytecode.Lines)
+	}
+
+	// the operator is back on the line of the '+' once 'a' was compiled,
+	// the implicit return belongs to the function literal
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	expected = code.LineTable{{Offset: 0, Line: 3}, {Offset: 2, Line: 4}, {Offset: 5, Line: 3}, {Offset: 6, Line: 2}}
+	if fmt.Sprint(fn.Lines) != fmt.Sprint(expected) {
+		t.Errorf("wrong function lines. expected=%v [actual=%v]", expected, fn.Lines)
+	}
+}
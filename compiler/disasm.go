@@ -0,0 +1,150 @@
+package compiler
+
+import (
+	"fmt"
+	"gomonkey/code"
+	"gomonkey/object"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+  Prints the instructions of the top level and of every function in the
+  constant pool. Each line has the offset, the source line, the
+  instruction and, after a ';', what its operand refers to:
+
+    == main ==
+    0000    1 OpClosure 0            ; fn(x)
+    0003    1 OpSetGlobal 0          ; double
+*/
+func Disassemble(w io.Writer, b *Bytecode) {
+	program := &object.Program{Constants: b.Constants, GlobalNames: b.GlobalNames}
+	main := &object.CompiledFunction{Instructions: b.Instructions, Lines: b.Lines}
+
+	fmt.Fprintln(w, "== main ==")
+	disassembleFunction(w, program, main)
+
+	for i, constant := range b.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "\n== constant %d: %s ==\n", i, FunctionName(fn))
+		if len(fn.Locals) > 0 {
+			fmt.Fprintf(w, "locals: %s\n", strings.Join(fn.Locals, ", "))
+		}
+		if len(fn.Captures) > 0 {
+			names := []string{}
+			for _, capture := range fn.Captures {
+				names = append(names, capture.Name)
+			}
+			fmt.Fprintf(w, "free: %s\n", strings.Join(names, ", "))
+		}
+		disassembleFunction(w, program, fn)
+	}
+}
+
+func disassembleFunction(w io.Writer, program *object.Program, fn *object.CompiledFunction) {
+	for offset := 0; offset < len(fn.Instructions); {
+		text, next := FormatInstruction(program, fn, offset)
+		fmt.Fprintln(w, text)
+		offset = next
+	}
+}
+
+/* "fn(a, b)", the name functions go by in listings and traces */
+func FunctionName(fn *object.CompiledFunction) string {
+	if fn.NumParameters > len(fn.Locals) {
+		return "fn(?)"
+	}
+	return "fn(" + strings.Join(fn.Locals[:fn.NumParameters], ", ") + ")"
+}
+
+/*
+  Formats the instruction of fn at offset and returns it together with
+  the offset of the next one. Constants and global names are looked up in
+  program, local and free variable names in fn
+*/
+func FormatInstruction(program *object.Program, fn *object.CompiledFunction, offset int) (string, int) {
+	ins := fn.Instructions
+	line := "-"
+	if n := fn.Lines.Line(offset); n > 0 {
+		line = strconv.Itoa(n)
+	}
+
+	def, err := code.Lookup(ins[offset])
+	if err != nil {
+		return fmt.Sprintf("%04d %4s ERROR: %s", offset, line, err), offset + 1
+	}
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	if offset+1+width > len(ins) {
+		return fmt.Sprintf("%04d %4s ERROR: truncated %s", offset, line, def.Name), len(ins)
+	}
+	operands, read := code.ReadOperands(def, ins[offset+1:])
+
+	text := fmt.Sprintf("%04d %4s %s", offset, line, code.FormatInstruction(def, operands))
+	if comment := describeOperand(program, fn, code.Opcode(ins[offset]), operands); comment != "" {
+		text = fmt.Sprintf("%-32s ; %s", text, comment)
+	}
+	return text, offset + 1 + read
+}
+
+/* What the first operand of op refers to, "" when it is just a number */
+func describeOperand(program *object.Program, fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+	if len(operands) == 0 {
+		return ""
+	}
+	index := operands[0]
+	name := func(names []string) string {
+		if index < len(names) {
+			return names[index]
+		}
+		return "?"
+	}
+
+	switch op {
+	case code.OpConstant, code.OpClosure, code.OpMember, code.OpImport, code.OpQuote:
+		if index >= len(program.Constants) {
+			return "?"
+		}
+		return describeConstant(program.Constants[index])
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+		return name(program.GlobalNames)
+	case code.OpGetLocal, code.OpSetLocal:
+		return name(fn.Locals)
+	case code.OpGetFree, code.OpSetFree:
+		names := []string{}
+		for _, capture := range fn.Captures {
+			names = append(names, capture.Name)
+		}
+		return name(names)
+	case code.OpGetBuiltin:
+		if index < len(object.Builtins) {
+			return object.Builtins[index].Name
+		}
+		return "?"
+	case code.OpSetIndex:
+		if index == 0 {
+			return ""
+		}
+		if def, err := code.Lookup(byte(index)); err == nil {
+			return def.Name
+		}
+		return "?"
+	}
+	return ""
+}
+
+func describeConstant(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	case *object.CompiledFunction:
+		return FunctionName(constant)
+	}
+	return constant.Inspect()
+}
@@ -0,0 +1,71 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := "let double = fn(x) {\n  x * 2\n};\nputs(double(\"s\"))"
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `== main ==
+0000    1 OpClosure 1            ; fn(x)
+0003    1 OpSetGlobal 0          ; double
+0006    4 OpGetBuiltin 1         ; puts
+0008    4 OpGetGlobal 0          ; double
+0011    4 OpConstant 2           ; "s"
+0014    4 OpCall 1
+0016    4 OpCall 1
+0018    4 OpReturnValue
+
+== constant 1: fn(x) ==
+locals: x
+0000    2 OpGetLocal 0           ; x
+0002    2 OpConstant 0           ; 2
+0005    2 OpMul
+0006    1 OpReturnValue
+`
+	var out bytes.Buffer
+	Disassemble(&out, compiler.Bytecode())
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nexpected=%q\n[actual=%q]", expected, out.String())
+	}
+
+	// loaded bytecode lists the same
+	data, err := compiler.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	loaded := &Bytecode{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+	out.Reset()
+	Disassemble(&out, loaded)
+	if out.String() != expected {
+		t.Errorf("wrong listing of loaded bytecode.\nexpected=%q\n[actual=%q]", expected, out.String())
+	}
+}
+
+func TestDisassembleFreeVariables(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("fn(a) { fn() { a += 1 } }")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out bytes.Buffer
+	Disassemble(&out, compiler.Bytecode())
+
+	for _, line := range []string{
+		"free: a\n",
+		"0000    1 OpGetFree 0            ; a\n",
+		"0007    1 OpSetFree 0            ; a\n",
+	} {
+		if !bytes.Contains(out.Bytes(), []byte(line)) {
+			t.Errorf("listing should contain %q [actual=%q]", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gomonkey/code"
+	"gomonkey/object"
+	"hash/crc32"
+	"math"
+)
+
+/*
+  Layout of a precompiled file, integers are big endian:
+
+    header     magic "MKBC", format version (uint16), length of the
+               whole file
+    constants  count, then per constant a kind byte and its value.
+               Functions are stored as an index into the function table
+    functions  count, then per function its instructions, slot counts,
+               local names, captures, fallbacks, body source and lines
+    globals    count, then the name of each global slot
+    main       the top level instructions and their lines
+    checksum   CRC-32 (IEEE) of everything before it
+
+  Counts and lengths are uint32, strings are a length and UTF-8 bytes.
+  Loading a file only decodes this, the lexer and parser are not needed
+*/
+const (
+	Magic         = "MKBC"
+	FormatVersion = 2
+)
+
+var (
+	ErrNotBytecode = errors.New("not a monkey bytecode file")
+	ErrVersion     = errors.New("unsupported bytecode version")
+	ErrChecksum    = errors.New("bytecode checksum mismatch, the file is corrupted")
+	ErrTruncated   = errors.New("bytecode file is truncated")
+	ErrInvalid     = errors.New("invalid instruction in bytecode file")
+)
+
+/* Kinds of constants */
+const (
+	constInteger byte = iota + 1
+	constFloat
+	constString
+	constFunction
+)
+
+/* Whether data starts like a precompiled file */
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Writing ----------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  Encodes the bytecode in the precompiled file format. Only constants the
+  compiler creates for literals and functions can be stored, quote
+  expressions keep a syntax tree and make this fail
+*/
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	e := &encoder{}
+	e.buf.WriteString(Magic)
+	e.uint16(FormatVersion)
+	e.uint32(0) // the length, known at the end
+
+	functions := []*object.CompiledFunction{}
+	e.uint32(len(b.Constants))
+	for i, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			e.byte(constInteger)
+			e.uint64(uint64(constant.Value))
+		case *object.Float:
+			e.byte(constFloat)
+			e.uint64(math.Float64bits(constant.Value))
+		case *object.String:
+			e.byte(constString)
+			e.string(constant.Value)
+		case *object.CompiledFunction:
+			e.byte(constFunction)
+			e.uint32(len(functions))
+			functions = append(functions, constant)
+		case *object.Quote:
+			return nil, fmt.Errorf("cannot serialize constant %d: programs that use quote can't be precompiled", i)
+		default:
+			return nil, fmt.Errorf("cannot serialize constant %d of type %s", i, constant.Type())
+		}
+	}
+
+	e.uint32(len(functions))
+	for _, fn := range functions {
+		e.function(fn)
+	}
+
+	e.strings(b.GlobalNames)
+	e.bytes(b.Instructions)
+	e.lines(b.Lines)
+
+	data := e.buf.Bytes()
+	binary.BigEndian.PutUint32(data[len(Magic)+2:], uint32(len(data)+4))
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf.WriteByte(b)
+}
+
+func (e *encoder) uint16(n int) {
+	e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+}
+
+func (e *encoder) uint32(n int) {
+	e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+}
+
+func (e *encoder) uint64(n uint64) {
+	e.buf.Write(binary.BigEndian.AppendUint64(nil, n))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint32(len(b))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) strings(list []string) {
+	e.uint32(len(list))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) lines(lines code.LineTable) {
+	e.uint32(len(lines))
+	for _, entry := range lines {
+		e.uint32(entry.Offset)
+		e.uint32(entry.Line)
+	}
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) {
+	e.bytes(fn.Instructions)
+	e.uint32(fn.NumLocals)
+	e.uint32(fn.NumParameters)
+	e.strings(fn.Locals)
+
+	e.uint32(len(fn.Captures))
+	for _, capture := range fn.Captures {
+		if capture.Local {
+			e.byte(1)
+		} else {
+			e.byte(0)
+		}
+		e.uint32(capture.Index)
+		e.string(capture.Name)
+	}
+
+	e.uint32(len(fn.Fallbacks))
+	for _, fallback := range fn.Fallbacks {
+		e.uint32(fallback.Local)
+		e.string(fallback.Scope)
+		e.uint32(fallback.Index)
+	}
+
+	e.string(fn.Body)
+	e.lines(fn.Lines)
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Reading ----------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  Decodes a precompiled file. The magic, the version, the length and the
+  checksum are checked before anything else, in that order, so a file
+  written by another version is reported as such even though the rest of
+  its header may not make sense to this one, and a file cut short as
+  truncated rather than corrupted
+*/
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsBytecode(data) {
+		return ErrNotBytecode
+	}
+	if len(data) < len(Magic)+2 {
+		return ErrTruncated
+	}
+	if version := binary.BigEndian.Uint16(data[len(Magic):]); version != FormatVersion {
+		return fmt.Errorf("%w %d, expected version %d", ErrVersion, version, FormatVersion)
+	}
+	header := len(Magic) + 2 + 4
+	if len(data) < header+4 {
+		return ErrTruncated
+	}
+	length := int(binary.BigEndian.Uint32(data[len(Magic)+2:]))
+	if len(data) < length {
+		return ErrTruncated
+	}
+	if len(data) > length {
+		return fmt.Errorf("unexpected data at offset %d of bytecode file", length)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return ErrChecksum
+	}
+
+	d := &decoder{data: body, pos: header}
+
+	constants := make([]object.Object, d.count())
+	functionRefs := map[int]int{} // constant -> function table index
+	for i := range constants {
+		switch kind := d.byte(); kind {
+		case constInteger:
+			constants[i] = &object.Integer{Value: int64(d.uint64())}
+		case constFloat:
+			constants[i] = &object.Float{Value: math.Float64frombits(d.uint64())}
+		case constString:
+			constants[i] = &object.String{Value: d.string()}
+		case constFunction:
+			functionRefs[i] = d.uint32()
+		default:
+			if d.err == nil {
+				d.err = fmt.Errorf("unknown constant kind %d in bytecode file", kind)
+			}
+		}
+	}
+
+	functions := make([]*object.CompiledFunction, d.count())
+	for i := range functions {
+		functions[i] = d.function()
+	}
+	for i, ref := range functionRefs {
+		if ref >= len(functions) {
+			return fmt.Errorf("constant %d refers to missing function %d", i, ref)
+		}
+		constants[i] = functions[ref]
+	}
+
+	globalNames := d.strings()
+	instructions := code.Instructions(d.bytes())
+	lines := d.lines()
+	if d.err != nil {
+		return d.err
+	}
+	if d.pos != len(body) {
+		return fmt.Errorf("unexpected data at offset %d of bytecode file", d.pos)
+	}
+
+	loaded := Bytecode{
+		Instructions: instructions,
+		Constants:    constants,
+		GlobalNames:  globalNames,
+		Lines:        lines,
+	}
+	if err := loaded.check(&object.CompiledFunction{Instructions: instructions}, "main"); err != nil {
+		return err
+	}
+	for i, fn := range functions {
+		if err := loaded.check(fn, fmt.Sprintf("function %d", i)); err != nil {
+			return err
+		}
+	}
+	*b = loaded
+	return nil
+}
+
+/*
+  Makes sure the instructions of fn only refer to constants, globals,
+  slots and offsets the file has and can't run past their end, the VM
+  trusts its operands and would panic on a corrupted file otherwise.
+  What is left, like popping an empty stack, the VM reports as an error
+*/
+func (b *Bytecode) check(fn *object.CompiledFunction, name string) error {
+	ins := fn.Instructions
+	invalid := func(offset int, format string, a ...interface{}) error {
+		return fmt.Errorf("%w: %s at offset %d of %s", ErrInvalid, fmt.Sprintf(format, a...), offset, name)
+	}
+
+	starts := map[int]bool{}
+	jumps := [][2]int{} // offset and target of each jump
+	last := -1          // offset of the last instruction
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return invalid(ip, "%s", err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if ip+1+width > len(ins) {
+			return invalid(ip, "%s is cut short", def.Name)
+		}
+		starts[ip] = true
+		last = ip
+		operands, _ := code.ReadOperands(def, ins[ip+1:])
+
+		switch code.Opcode(ins[ip]) {
+		case code.OpConstant, code.OpClosure, code.OpMember, code.OpImport, code.OpQuote:
+			if operands[0] >= len(b.Constants) {
+				return invalid(ip, "%s refers to missing constant %d", def.Name, operands[0])
+			}
+			constant := b.Constants[operands[0]]
+			ok := true
+			switch code.Opcode(ins[ip]) {
+			case code.OpClosure:
+				_, ok = constant.(*object.CompiledFunction)
+			case code.OpMember, code.OpImport:
+				_, ok = constant.(*object.String)
+			case code.OpQuote:
+				_, ok = constant.(*object.Quote)
+			}
+			if !ok {
+				return invalid(ip, "%s can't use constant %d of type %s", def.Name, operands[0], constant.Type())
+			}
+			if closure, isFn := constant.(*object.CompiledFunction); isFn {
+				if err := checkCaptures(closure, fn); err != nil {
+					return invalid(ip, "%s of constant %d %s", def.Name, operands[0], err)
+				}
+			}
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			if operands[0] >= len(b.GlobalNames) {
+				return invalid(ip, "%s refers to missing global %d", def.Name, operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if operands[0] >= fn.NumLocals {
+				return invalid(ip, "%s refers to missing local %d", def.Name, operands[0])
+			}
+		case code.OpGetFree, code.OpSetFree:
+			if operands[0] >= len(fn.Captures) {
+				return invalid(ip, "%s refers to missing free variable %d", def.Name, operands[0])
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return invalid(ip, "%s refers to missing builtin %d", def.Name, operands[0])
+			}
+		case code.OpJump, code.OpJumpNotTruthy:
+			jumps = append(jumps, [2]int{ip, operands[0]})
+		}
+		ip += 1 + width
+	}
+
+	for _, jump := range jumps {
+		if !starts[jump[1]] {
+			return invalid(jump[0], "jump to %d is not the start of an instruction", jump[1])
+		}
+	}
+	if last < 0 {
+		return fmt.Errorf("%w: %s has no instructions", ErrInvalid, name)
+	}
+	switch code.Opcode(ins[last]) {
+	case code.OpReturn, code.OpReturnValue, code.OpJump:
+	default:
+		def, _ := code.Lookup(ins[last])
+		return invalid(last, "instructions end in %s instead of a return or jump", def.Name)
+	}
+
+	for _, fallback := range fn.Fallbacks {
+		limit := map[string]int{"GLOBAL": len(b.GlobalNames), "LOCAL": fn.NumLocals, "FREE": len(fn.Captures)}
+		if n, ok := limit[fallback.Scope]; !ok || fallback.Local >= fn.NumLocals || fallback.Index >= n {
+			return fmt.Errorf("%w: bad fallback for local %d of %s", ErrInvalid, fallback.Local, name)
+		}
+	}
+	return checkFallbackCycles(fn, name)
+}
+
+/*
+  The slots a closure of fn captures must exist in the function that
+  creates the closure, enclosing
+*/
+func checkCaptures(fn, enclosing *object.CompiledFunction) error {
+	for i, capture := range fn.Captures {
+		if capture.Local && capture.Index >= enclosing.NumLocals {
+			return fmt.Errorf("captures missing local %d as free variable %d", capture.Index, i)
+		}
+		if !capture.Local && capture.Index >= len(enclosing.Captures) {
+			return fmt.Errorf("captures missing free variable %d as free variable %d", capture.Index, i)
+		}
+	}
+	return nil
+}
+
+/*
+  An unbound local falls back to the slot its first fallback names, a
+  chain of local slots leading back to itself would never end
+*/
+func checkFallbackCycles(fn *object.CompiledFunction, name string) error {
+	next := map[int]int{}
+	for _, fallback := range fn.Fallbacks {
+		if _, ok := next[fallback.Local]; ok {
+			continue
+		}
+		next[fallback.Local] = -1
+		if fallback.Scope == "LOCAL" {
+			next[fallback.Local] = fallback.Index
+		}
+	}
+
+	for _, fallback := range fn.Fallbacks {
+		start := fallback.Local
+		seen := map[int]bool{}
+		for local := start; local >= 0; local = next[local] {
+			if seen[local] {
+				return fmt.Errorf("%w: fallbacks for local %d of %s form a cycle", ErrInvalid, start, name)
+			}
+			seen[local] = true
+			if _, ok := next[local]; !ok {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+/* Reads the values the encoder wrote, the first error sticks */
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.data)-d.pos {
+		if d.err == nil {
+			d.err = ErrTruncated
+		}
+		return make([]byte, max(n, 0))
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) byte() byte {
+	return d.next(1)[0]
+}
+
+func (d *decoder) uint32() int {
+	return int(binary.BigEndian.Uint32(d.next(4)))
+}
+
+func (d *decoder) uint64() uint64 {
+	return binary.BigEndian.Uint64(d.next(8))
+}
+
+/*
+  A count of items that take at least one byte each, so a corrupted count
+  can't make us allocate more than the file could hold
+*/
+func (d *decoder) count() int {
+	n := d.uint32()
+	if n > len(d.data)-d.pos {
+		if d.err == nil {
+			d.err = ErrTruncated
+		}
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	b := d.next(d.uint32())
+	return append([]byte{}, b...)
+}
+
+func (d *decoder) string() string {
+	return string(d.next(d.uint32()))
+}
+
+func (d *decoder) strings() []string {
+	list := make([]string, d.count())
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+func (d *decoder) lines() code.LineTable {
+	lines := make(code.LineTable, d.count())
+	for i := range lines {
+		lines[i] = code.LineEntry{Offset: d.uint32(), Line: d.uint32()}
+	}
+	return lines
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Instructions:  d.bytes(),
+		NumLocals:     d.uint32(),
+		NumParameters: d.uint32(),
+		Locals:        d.strings(),
+	}
+
+	fn.Captures = make([]object.Capture, d.count())
+	for i := range fn.Captures {
+		fn.Captures[i] = object.Capture{Local: d.byte() == 1, Index: d.uint32(), Name: d.string()}
+	}
+	fn.Fallbacks = make([]object.Fallback, d.count())
+	for i := range fn.Fallbacks {
+		fn.Fallbacks[i] = object.Fallback{Local: d.uint32(), Scope: d.string(), Index: d.uint32()}
+	}
+
+	fn.Body = d.string()
+	fn.Lines = d.lines()
+	if d.err == nil && (fn.NumParameters > fn.NumLocals || len(fn.Locals) != fn.NumLocals) {
+		d.err = fmt.Errorf("invalid function in bytecode file")
+	}
+	return fn
+}
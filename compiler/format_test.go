@@ -0,0 +1,205 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gomonkey/code"
+	"gomonkey/object"
+	"reflect"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `let x = 1.5;
+let greet = fn(name) {
+  let x = x + 1;
+  fn() { "hello " + name }
+};
+[x, 2, greet("you")()]`
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	if !IsBytecode(data) {
+		t.Errorf("file should start with the magic [actual=%q]", data[:4])
+	}
+	loaded := &Bytecode{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+
+	if loaded.Instructions.String() != bytecode.Instructions.String() {
+		t.Errorf("wrong instructions. expected=%q [actual=%q]",
+			bytecode.Instructions.String(), loaded.Instructions.String())
+	}
+	if !reflect.DeepEqual(loaded.GlobalNames, bytecode.GlobalNames) {
+		t.Errorf("wrong global names. expected=%v [actual=%v]", bytecode.GlobalNames, loaded.GlobalNames)
+	}
+	if !reflect.DeepEqual(loaded.Lines, bytecode.Lines) {
+		t.Errorf("wrong lines. expected=%v [actual=%v]", bytecode.Lines, loaded.Lines)
+	}
+	if len(loaded.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. expected=%d [actual=%d]",
+			len(bytecode.Constants), len(loaded.Constants))
+	}
+	// %v doesn't tell nil and empty slices apart
+	for i, constant := range bytecode.Constants {
+		expected, actual := fmt.Sprintf("%v", constant), fmt.Sprintf("%v", loaded.Constants[i])
+		if actual != expected {
+			t.Errorf("wrong constant %d. expected=%s [actual=%s]", i, expected, actual)
+		}
+	}
+}
+
+func TestBytecodeLoadErrors(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("let f = fn(x) { x * 2 }; f(21)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	data, err := compiler.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	modify := func(f func(data []byte) []byte) []byte {
+		return f(append([]byte{}, data...))
+	}
+	tests := []struct {
+		data     []byte
+		expected error
+		message  string
+	}{
+		{[]byte("let x = 1;"), ErrNotBytecode, "not a monkey bytecode file"},
+		{data[:5], ErrTruncated, "bytecode file is truncated"},
+		{modify(func(d []byte) []byte {
+			binary.BigEndian.PutUint16(d[4:], 7)
+			return d
+		}), ErrVersion, "unsupported bytecode version 7, expected version 2"},
+		{modify(func(d []byte) []byte {
+			d[len(d)/2] ^= 0xff
+			return d
+		}), ErrChecksum, "bytecode checksum mismatch, the file is corrupted"},
+		{data[:len(data)-1], ErrTruncated, "bytecode file is truncated"},
+		{data[:len(data)/2], ErrTruncated, "bytecode file is truncated"},
+	}
+	for _, tt := range tests {
+		err := (&Bytecode{}).UnmarshalBinary(tt.data)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("wrong error. expected=%q [actual=%v]", tt.expected, err)
+			continue
+		}
+		if err.Error() != tt.message {
+			t.Errorf("wrong message. expected=%q [actual=%q]", tt.message, err.Error())
+		}
+	}
+}
+
+func TestBytecodeWithQuote(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("quote(1 + 2)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	_, err := compiler.Bytecode().MarshalBinary()
+	expected := "cannot serialize constant 0: programs that use quote can't be precompiled"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q [actual=%v]", expected, err)
+	}
+}
+
+func TestBytecodeInvalidInstructions(t *testing.T) {
+	fn := &object.CompiledFunction{
+		Instructions: concatInstructions([]code.Instructions{
+			code.Make(code.OpGetLocal, 1),
+			code.Make(code.OpReturnValue),
+		}),
+		NumLocals:     1,
+		NumParameters: 1,
+		Locals:        []string{"x"},
+	}
+	closureMain := concatInstructions([]code.Instructions{code.Make(code.OpClosure, 0), code.Make(code.OpReturnValue)})
+	returnFree := concatInstructions([]code.Instructions{code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue)})
+	tests := []struct {
+		bytecode *Bytecode
+		message  string
+	}{
+		{&Bytecode{Instructions: code.Make(code.OpConstant, 65535)},
+			"OpConstant refers to missing constant 65535 at offset 0 of main"},
+		{&Bytecode{
+			Instructions: code.Make(code.OpMember, 0),
+			Constants:    []object.Object{&object.Integer{Value: 1}},
+		}, "OpMember can't use constant 0 of type INTEGER at offset 0 of main"},
+		{&Bytecode{
+			Instructions: concatInstructions([]code.Instructions{code.Make(code.OpNull), code.Make(code.OpSetGlobal, 1)}),
+			GlobalNames:  []string{"a"},
+		}, "OpSetGlobal refers to missing global 1 at offset 1 of main"},
+		{&Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			"OpGetLocal refers to missing local 0 at offset 0 of main"},
+		{&Bytecode{Instructions: code.Make(code.OpGetBuiltin, 255)},
+			"OpGetBuiltin refers to missing builtin 255 at offset 0 of main"},
+		{&Bytecode{Instructions: concatInstructions([]code.Instructions{code.Make(code.OpJump, 2), code.Make(code.OpNull)})},
+			"jump to 2 is not the start of an instruction at offset 0 of main"},
+		{&Bytecode{Instructions: code.Instructions{255}},
+			"opcode 255 undefined at offset 0 of main"},
+		{&Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2]},
+			"OpConstant is cut short at offset 0 of main"},
+		{&Bytecode{
+			Instructions: closureMain,
+			Constants:    []object.Object{fn},
+		}, "OpGetLocal refers to missing local 1 at offset 0 of function 0"},
+		{&Bytecode{Instructions: code.Make(code.OpNull)},
+			"instructions end in OpNull instead of a return or jump at offset 0 of main"},
+		{&Bytecode{
+			Instructions: closureMain,
+			Constants:    []object.Object{&object.CompiledFunction{Instructions: code.Make(code.OpNull)}},
+		}, "instructions end in OpNull instead of a return or jump at offset 0 of function 0"},
+		{&Bytecode{
+			Instructions: closureMain,
+			Constants:    []object.Object{&object.CompiledFunction{}},
+		}, "function 0 has no instructions"},
+		{&Bytecode{
+			Instructions: closureMain,
+			Constants: []object.Object{&object.CompiledFunction{
+				Instructions: returnFree,
+				Captures:     []object.Capture{{Local: true, Index: 50, Name: "x"}},
+			}},
+		}, "OpClosure of constant 0 captures missing local 50 as free variable 0 at offset 0 of main"},
+		{&Bytecode{
+			Instructions: closureMain,
+			Constants: []object.Object{&object.CompiledFunction{
+				Instructions: returnFree,
+				Captures:     []object.Capture{{Local: false, Index: 0, Name: "x"}},
+			}},
+		}, "OpClosure of constant 0 captures missing free variable 0 as free variable 0 at offset 0 of main"},
+		{&Bytecode{
+			Instructions: closureMain,
+			Constants: []object.Object{&object.CompiledFunction{
+				Instructions: concatInstructions([]code.Instructions{code.Make(code.OpGetLocal, 0), code.Make(code.OpReturnValue)}),
+				NumLocals:    1,
+				Locals:       []string{"x"},
+				Fallbacks:    []object.Fallback{{Local: 0, Scope: "LOCAL", Index: 0}},
+			}},
+		}, "fallbacks for local 0 of function 0 form a cycle"},
+	}
+	for _, tt := range tests {
+		data, err := tt.bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshal error: %s", err)
+		}
+		err = (&Bytecode{}).UnmarshalBinary(data)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("wrong error. expected=%q [actual=%v]", ErrInvalid, err)
+			continue
+		}
+		expected := ErrInvalid.Error() + ": " + tt.message
+		if err.Error() != expected {
+			t.Errorf("wrong message. expected=%q [actual=%q]", expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+/* A name resolved to the slot that holds its value */
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+/*
+  Names visible in a scope. There is one table for the top level and one
+  per function, plus block tables for the arms of match expressions: they
+  have names of their own but take their slots from the enclosing function
+  (or the top level), like the evaluator's scope for an arm
+*/
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// the enclosing function's variables this function uses, in the
+	// order the closure captures them
+	FreeSymbols []Symbol
+
+	// slots that stand for an outer variable until their let has run,
+	// only kept by function tables
+	Shadows []Shadow
+
+	store map[string]Symbol
+	block bool
+	names []string // slot -> name, only kept by function and global tables
+}
+
+/* Where the name of local slot Index is found before the slot is bound */
+type Shadow struct {
+	Index int
+	Outer Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+/* Table for the body of a function literal */
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+/* Table for a nested scope that shares the slots of outer */
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+/* Defining a name again in the same scope gives back its existing slot */
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	owner := s.owner()
+	symbol := Symbol{Name: name, Index: len(owner.names), Scope: LocalScope}
+	if owner.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	owner.names = append(owner.names, name)
+	s.store[name] = symbol
+	return symbol
+}
+
+/*
+  Defines a name that may also be bound in an enclosing scope. The
+  evaluator keeps finding the outer binding until the let runs, so the
+  slot remembers where that lives. The top level has nothing to shadow
+  but builtins, which the VM falls back to anyway
+*/
+func (s *SymbolTable) DefineShadowing(name string) Symbol {
+	_, defined := s.store[name]
+	symbol := s.Define(name)
+	owner := s.owner()
+	if defined || owner.Outer == nil {
+		return symbol
+	}
+
+	outer, ok := s.Outer.Resolve(name)
+	if !ok || outer.Scope == BuiltinScope {
+		return symbol
+	}
+	if !s.block && outer.Scope != GlobalScope {
+		outer = s.capture(outer)
+	}
+	owner.Shadows = append(owner.Shadows, Shadow{Index: symbol.Index, Outer: outer})
+	return symbol
+}
+
+/*
+  Takes a slot no name resolves to, for a parameter hidden by a later
+  one with the same name
+*/
+func (s *SymbolTable) DefineHidden(name string) Symbol {
+	owner := s.owner()
+	symbol := Symbol{Name: name, Index: len(owner.names), Scope: LocalScope}
+	owner.names = append(owner.names, name)
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+/*
+  Looks name up in this scope and then in the enclosing ones. A local of
+  an enclosing function becomes a free variable of this one
+*/
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.block || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	return s.defineFree(symbol), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	symbol := s.capture(original)
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+/* Adds a free variable without making it visible under its name */
+func (s *SymbolTable) capture(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	return Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+}
+
+/* The names of the slots, indexed by slot */
+func (s *SymbolTable) Names() []string {
+	return s.owner().names
+}
+
+/* Number of slots of the function, or globals of the top level */
+func (s *SymbolTable) NumDefinitions() int {
+	return len(s.owner().names)
+}
+
+/* The outermost table, where globals and builtins live */
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+/* The table whose slots a block table uses */
+func (s *SymbolTable) owner() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
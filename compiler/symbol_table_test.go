@@ -0,0 +1,90 @@
+package compiler
+
+import "testing"
+
+func TestDefineAndResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	a := global.Define("a")
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a should reuse its slot. expected=%+v [actual=%+v]", a, again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	arm := NewBlockSymbolTable(local)
+	c := arm.Define("c")
+	nested := NewEnclosedSymbolTable(arm)
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{global, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{local, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{local, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{arm, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{arm, "c", Symbol{Name: "c", Scope: LocalScope, Index: 1}},
+		{nested, "c", Symbol{Name: "c", Scope: FreeScope, Index: 0}},
+		{nested, "b", Symbol{Name: "b", Scope: FreeScope, Index: 1}},
+		{nested, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+	}
+	for _, tt := range tests {
+		symbol, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if symbol != tt.expected {
+			t.Errorf("wrong symbol for %s. expected=%+v [actual=%+v]", tt.name, tt.expected, symbol)
+		}
+	}
+
+	// the arm takes its slots from the function, the free variables of
+	// the nested function are captured from there
+	if b.Index == c.Index || local.NumDefinitions() != 2 {
+		t.Errorf("arm should use a slot of the function [actual=%d slots]", local.NumDefinitions())
+	}
+	expectedFree := []Symbol{c, b}
+	for i, s := range nested.FreeSymbols {
+		if s != expectedFree[i] {
+			t.Errorf("wrong free symbol %d. expected=%+v [actual=%+v]", i, expectedFree[i], s)
+		}
+	}
+	if _, ok := nested.Resolve("missing"); ok {
+		t.Errorf("name missing should not be resolvable")
+	}
+}
+
+func TestDefineShadowing(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("g")
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("x")
+	inner := NewEnclosedSymbolTable(outer)
+	inner.Define("p")
+
+	x := inner.DefineShadowing("x")
+	g := inner.DefineShadowing("g")
+	inner.DefineShadowing("p")
+	inner.DefineShadowing("fresh")
+
+	expected := []Shadow{
+		{Index: x.Index, Outer: Symbol{Name: "x", Scope: FreeScope, Index: 0}},
+		{Index: g.Index, Outer: Symbol{Name: "g", Scope: GlobalScope, Index: 0}},
+	}
+	if len(inner.Shadows) != len(expected) {
+		t.Fatalf("wrong number of shadows. expected=%d [actual=%+v]", len(expected), inner.Shadows)
+	}
+	for i, shadow := range expected {
+		if inner.Shadows[i] != shadow {
+			t.Errorf("wrong shadow %d. expected=%+v [actual=%+v]", i, shadow, inner.Shadows[i])
+		}
+	}
+	// the captured x is not visible under its name, the local is
+	if symbol, _ := inner.Resolve("x"); symbol != x {
+		t.Errorf("x should resolve to the local. expected=%+v [actual=%+v]", x, symbol)
+	}
+}
@@ -0,0 +1,1040 @@
+package evaluator
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/object"
+	"math"
+	"strings"
+)
+
+/* There is only ever one true, one false and one null */
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+/*
+  Calls nested deeper than this fail with a stack overflow error, well
+  before the Go stack they run on would overflow and abort the process
+*/
+const MaxCallDepth = 50000
+
+/*
+ *
+ * Main Recursive evaluation function
+ *
+ */
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Code:
+		return evalCode(node, env)
+
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := Eval(node.Value, env)
+		if interrupts(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if interrupts(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if interrupts(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+		left := Eval(node.Left, env)
+		if interrupts(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if interrupts(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+
+	case *ast.MacroLiteral:
+		return newError("macros can only be defined by a top level let statement")
+
+	case *ast.CallExpression:
+		if isCallTo(node, "quote") {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments: expected 1, got %d",
+					len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+		function := Eval(node.Function, env)
+		if interrupts(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && interrupts(args[0]) {
+			return args[0]
+		}
+		return applyFunction(function, args, env.Depth()+1)
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && interrupts(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.MemberExpression:
+		return evalMemberExpression(node, env)
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if interrupts(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if interrupts(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	default:
+		return newError("unsupported node: %T", node)
+	}
+
+	return nil
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Statements -------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* Top level, a return value is unwrapped here and stops the program */
+func evalCode(code *ast.Code, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range code.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		case *object.Break, *object.Continue:
+			return newError("%s outside of a loop", result.Inspect())
+		}
+	}
+
+	return result
+}
+
+/*
+  Nested blocks keep the return value wrapped so the outer blocks stop
+  evaluating as well. Break and continue unwind the same way up to the
+  innermost loop. An empty block, or one ending in a let, gives null
+*/
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if result != nil && stopsBlock(result) {
+			return result
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func stopsBlock(obj object.Object) bool {
+	switch obj.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	}
+	return false
+}
+
+/* Loops are statements, they evaluate to null */
+func evalWhileStatement(loop *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		if err := cancelled(env); err != nil {
+			return err
+		}
+		condition := Eval(loop.Condition, env)
+		if interrupts(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := Eval(loop.Body, env)
+		if result, done := loopControl(result); done {
+			return result
+		}
+	}
+}
+
+/*
+  Like if blocks, loops don't open a scope of their own: the variable is
+  bound in the enclosing scope and keeps the last value after the loop
+*/
+func evalForStatement(loop *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(loop.Iterable, env)
+	if interrupts(iterable) {
+		return iterable
+	}
+
+	items, err := iterationItems(iterable)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := cancelled(env); err != nil {
+			return err
+		}
+		env.Set(loop.Variable.Value, item)
+
+		result := Eval(loop.Body, env)
+		if result, done := loopControl(result); done {
+			return result
+		}
+	}
+	return NULL
+}
+
+/* Array elements, the characters of a string or the keys of a hash */
+func iterationItems(iterable object.Object) ([]object.Object, *object.Error) {
+	var items []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		items = iterable.Elements
+	case *object.String:
+		for _, char := range iterable.Value {
+			items = append(items, &object.String{Value: string(char)})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			items = append(items, pair.Key)
+		}
+	default:
+		return nil, newError("not iterable: %s", iterable.Type())
+	}
+	return items, nil
+}
+
+/*
+  What a loop does with the result of its body: break ends the loop,
+  return and errors end it and keep going up, anything else carries on
+*/
+func loopControl(result object.Object) (object.Object, bool) {
+	if result == nil {
+		return nil, false
+	}
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return NULL, true
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	}
+	return nil, false
+}
+
+/* Binds the module to its alias in the current scope */
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	loader := env.Loader()
+	if loader == nil {
+		return newError("cannot import %q: no module loader configured", node.Path.Value)
+	}
+	module := loader.Import(node.Path.Value)
+	if interrupts(module) {
+		return module
+	}
+	env.Set(node.Alias.Value, module)
+	return nil
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Expressions ------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* Bindings shadow builtins of the same name */
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
+	}
+	return newError("identifier not found: %s", node.Value)
+}
+
+// Prefix operators
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		if right, ok := right.(*object.Integer); ok {
+			return &object.Integer{Value: ^right.Value}
+		}
+		return newError("unknown operator: ~%s", right.Type())
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	if isTruthy(right) {
+		return FALSE
+	}
+	return TRUE
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+// Infix operators
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	// Booleans and null are singletons so pointer comparison is enough
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+/*
+  && and || only evaluate the right side when the left one doesn't decide
+  the result already. Both operands are judged by truthiness and the
+  result is always a boolean
+*/
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if interrupts(left) {
+		return left
+	}
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if interrupts(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+/*
+  Integer arithmetic wraps around on overflow like Go's does. A negative
+  exponent can't give an integer, 2 ** -1 is the float 0.5. Shifts take
+  counts from 0 to 63, >> keeps the sign
+*/
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %d / %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %d %% %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		return &object.Integer{Value: integerPower(leftVal, rightVal)}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d %s %d", leftVal, operator, rightVal)
+		}
+		if rightVal >= 64 {
+			return newError("shift count too large: %d %s %d", leftVal, operator, rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+/*
+  At least one side is a float, the other one is promoted so 1 + 0.5 is
+  1.5 and 2 == 2.0 is true. The result of arithmetic is always a float
+*/
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %s %% %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+/* Concatenation and lexicographic (byte-wise) comparison */
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// Index operator
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.ARRAY_OBJ:
+		return newError("array index must be INTEGER, got %s", index.Type())
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+/* Negative indexes count from the end, -1 is the last element */
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+	idx := index.(*object.Integer).Value
+	length := int64(len(elements))
+
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 || idx >= length {
+		return newError("index out of range: %d (length %d)",
+			index.(*object.Integer).Value, length)
+	}
+	return elements[idx]
+}
+
+/* A missing key gives null */
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+	if value, ok := hash.(*object.Hash).Get(key); ok {
+		return value
+	}
+	return NULL
+}
+
+// Modules
+/* Only the exported bindings of a module can be reached */
+func evalMemberExpression(node *ast.MemberExpression, env *object.Environment) object.Object {
+	obj := Eval(node.Object, env)
+	if interrupts(obj) {
+		return obj
+	}
+	return evalMember(obj, node.Member.Value)
+}
+
+func evalMember(obj object.Object, name string) object.Object {
+	module, ok := obj.(*object.Module)
+	if !ok {
+		return newError("member access not supported: %s", obj.Type())
+	}
+	value, ok := module.Exports[name]
+	if !ok {
+		return newError("module %q does not export %s", module.Path, name)
+	}
+	return value
+}
+
+// Assignment
+/*
+  Assignments evaluate to the assigned value. Compound operators apply
+  the infix operator to the current value, so x += 1 is x = x + 1 with x
+  evaluated only once. Arrays and hashes are updated in place
+*/
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if node.Operator != "=" {
+			current = evalIdentifier(target, env)
+			if interrupts(current) {
+				return current
+			}
+		}
+		value := evalAssignedValue(node, current, env)
+		if interrupts(value) {
+			return value
+		}
+		if !env.Assign(target.Value, value) {
+			return newError("assignment to undeclared identifier: %s", target.Value)
+		}
+		return value
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if interrupts(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if interrupts(index) {
+			return index
+		}
+		var current object.Object
+		if node.Operator != "=" {
+			current = evalIndexExpression(left, index)
+			if interrupts(current) {
+				return current
+			}
+		}
+		value := evalAssignedValue(node, current, env)
+		if interrupts(value) {
+			return value
+		}
+		return evalIndexAssignment(left, index, value)
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+/* The value to store, current is the old value for compound operators */
+func evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	value := Eval(node.Value, env)
+	if interrupts(value) || node.Operator == "=" {
+		return value
+	}
+	operator := strings.TrimSuffix(node.Operator, "=")
+	return evalInfixExpression(operator, current, value)
+}
+
+func evalIndexAssignment(left, index, value object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		length := int64(len(left.Elements))
+		i := idx.Value
+		if i < 0 {
+			i += length
+		}
+		if i < 0 || i >= length {
+			return newError("index out of range: %d (length %d)", idx.Value, length)
+		}
+		left.Elements[i] = value
+		return value
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, value)
+		return value
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+// Hashes
+/* Pairs are evaluated in source order, a repeated key keeps the last value */
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if interrupts(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if interrupts(value) {
+			return value
+		}
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+// If statements
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if interrupts(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	}
+	return NULL
+}
+
+// Match expressions
+/*
+  The first arm whose pattern matches is evaluated in a new scope holding
+  the names bound by the pattern. The parser makes sure there is a default
+  arm, null is only returned for hand built ASTs without one
+*/
+func evalMatchExpression(match *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(match.Subject, env)
+	if interrupts(subject) {
+		return subject
+	}
+
+	for _, arm := range match.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+		matched, err := matchPattern(arm.Pattern, subject, armEnv)
+		if err != nil {
+			return err
+		}
+		if matched {
+			return Eval(arm.Body, armEnv)
+		}
+	}
+	return NULL
+}
+
+/* Binds the names in pattern to the matching parts of value in env */
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+
+	case *ast.BindingPattern:
+		env.Set(pattern.Name.Value, value)
+		return true, nil
+
+	case *ast.LiteralPattern:
+		literal := Eval(pattern.Value, env)
+		if err, ok := literal.(*object.Error); ok {
+			return false, err
+		}
+		// a type mismatch is not an error here, it just doesn't match
+		return evalInfixExpression("==", literal, value) == TRUE, nil
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok || len(array.Elements) != len(pattern.Elements) {
+			return false, nil
+		}
+		for i, element := range pattern.Elements {
+			if matched, err := matchPattern(element, array.Elements[i], env); !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		for _, pair := range pattern.Pairs {
+			key, ok := Eval(pair.Key, env).(object.Hashable)
+			if !ok {
+				return false, newError("unusable as hash key: %s", pair.Key.String())
+			}
+			element, ok := hash.Get(key)
+			if !ok {
+				return false, nil
+			}
+			if matched, err := matchPattern(pair.Value, element, env); !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	default:
+		return false, newError("unsupported pattern: %T", pattern)
+	}
+}
+
+// Function calls
+/* Arguments are evaluated left to right, the first error or signal stops the call */
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if interrupts(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+/* depth is the number of calls the function runs in, this one included */
+func applyFunction(fn object.Object, args []object.Object, depth int) object.Object {
+	switch function := fn.(type) {
+	case *object.Function:
+		if len(args) != len(function.Parameters) {
+			return newError("wrong number of arguments: expected %d, got %d",
+				len(function.Parameters), len(args))
+		}
+		if depth > MaxCallDepth {
+			return newError("stack overflow")
+		}
+		if err := cancelled(function.Env); err != nil {
+			return err
+		}
+		extendedEnv := extendFunctionEnv(function, args)
+		extendedEnv.SetDepth(depth)
+		evaluated := unwrapReturnValue(Eval(function.Body, extendedEnv))
+		if evaluated == nil {
+			return NULL
+		}
+		return evaluated
+
+	case *object.Builtin:
+		if result := function.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
+
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+/*
+  Calls a function value with arguments that are already evaluated, eg.
+  from a Go program that embeds the evaluator
+*/
+func Apply(fn object.Object, args []object.Object) object.Object {
+	return applyFunction(fn, args, 1)
+}
+
+/*
+  Loops and function calls check the context of the environment, that's
+  enough to stop any program that runs for long
+*/
+func cancelled(env *object.Environment) *object.Error {
+	ctx := env.Context()
+	if ctx == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return newError("evaluation stopped: %s", ctx.Err())
+	default:
+		return nil
+	}
+}
+
+/* Parameters live in a new scope enclosed by the function's defining scope */
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+	for i, param := range fn.Parameters {
+		env.Set(param.Value, args[i])
+	}
+	return env
+}
+
+/*
+  A return only unwinds up to the function it was called in. The parser
+  rejects break and continue outside of loops, this catches hand built
+  ASTs so they can't escape the function either
+*/
+func unwrapReturnValue(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case *object.Break, *object.Continue:
+		return newError("%s outside of a loop", obj.Inspect())
+	}
+	return obj
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Operations shared with the VM ------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  The bytecode VM applies operators through these so both backends give
+  the same results and the same error messages. Errors are returned as
+  *object.Error values, just like Eval does
+*/
+
+func Infix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func Prefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func Index(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+/* Stores value at left[index] and returns it */
+func SetIndex(left, index, value object.Object) object.Object {
+	return evalIndexAssignment(left, index, value)
+}
+
+/* The export name of a module */
+func Member(obj object.Object, name string) object.Object {
+	return evalMember(obj, name)
+}
+
+/* What a for loop iterates over */
+func IterationItems(iterable object.Object) ([]object.Object, *object.Error) {
+	return iterationItems(iterable)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Helpers ----------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+/* Only false and null are falsy, everything else (including 0) is truthy */
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+/* Exponentiation by squaring, exp must not be negative */
+func integerPower(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+/*
+  Errors and the return, break and continue signals end the evaluation of
+  any expression they turn up in, which passes them on unchanged
+*/
+func interrupts(obj object.Object) bool {
+	return obj != nil && stopsBlock(obj)
+}
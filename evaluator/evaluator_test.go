@@ -0,0 +1,978 @@
+package evaluator
+
+import (
+	"context"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"testing"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+/* int op int stays an int, a float on either side makes the result a float */
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"2 * 1e3", 2000},
+		{"0x10 * 0.5", 8},
+		{"(1_000 - 0.5) * 2", 1999},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestMixedNumberComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"2 == 2.0", true},
+		{"2.0 != 2", false},
+		{"1 < 1.5", true},
+		{"2.5 > 3", false},
+		{"10 / 4", 2},
+		{"1.0 / 0", "division by zero: 1.0 / 0"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2.0", "2.0"},
+		{"1 + 0.25", "1.25"},
+		{"1e21", "1e+21"},
+		{"-0.5", "-0.5"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %q [actual=%q]", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
+		{"if (true) { let z = 1; }", nil},
+		{"if (false) { 10 } else { }", nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`, "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"10 / (5 - 5)", "division by zero: 10 / 0"},
+		{"if (true) { } + 1", "type mismatch: NULL + INTEGER"},
+		{"-if (true) { let z = 1; }", "unknown operator: -NULL"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned [actual=%T(%+v)]", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q [actual=%q]",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let café = 5; let 数 = 2; café * 数;", 10},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	code := p.ParseCode()
+	env := object.NewEnvironment()
+	return Eval(code, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer [actual=%T (%+v)]", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. expected=%d [actual=%d]",
+			expected, result.Value)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean [actual=%T (%+v)]", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. expected=%t [actual=%t]",
+			expected, result.Value)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL [actual=%T (%+v)]", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function [actual=%T (%+v)]", evaluated, evaluated)
+	}
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters [actual=%+v]", fn.Parameters)
+	}
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x' [actual=%q]", fn.Parameters[0])
+	}
+	expectedBody := "(x + 2)"
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q [actual=%q]", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn(x) { return x; 10; }; f(1) + 1;", 2},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+/* A function with an empty body returns null */
+func TestEmptyFunctionBody(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn() {}; f()", nil},
+		{"fn(x) {}(1)", nil},
+		{"let f = fn() {}; f() + 1", "type mismatch: NULL + INTEGER"},
+		{"-fn() {}()", "unknown operator: -NULL"},
+		{"len([fn() {}()])", 1},
+		{"let f = fn() { let x = 1; }; f()", nil},
+		{"true && fn() {}()", false},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	array := testEval("let f = fn() {}; [f()]")
+	if array.Inspect() != "[null]" {
+		t.Errorf("wrong array. expected=%q [actual=%q]", "[null]", array.Inspect())
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+let adder = fn(x) { fn(y) { x + y } };
+let addTwo = adder(2);
+addTwo(3);`, 5},
+		{`
+let add = fn(a, b) { a + b };
+let applyFunc = fn(a, b, func) { func(a, b) };
+applyFunc(2, 2, add);`, 4},
+		{`
+let x = 10;
+let shadow = fn(x) { x * 2 };
+shadow(1) + x;`, 12},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionApplicationErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let x = 5; x(1);", "not a function: INTEGER"},
+		{"fn(a, b) { a }(1);", "wrong number of arguments: expected 2, got 1"},
+		{"let f = fn(x) { x }; f(y);", "identifier not found: y"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned [actual=%T(%+v)]", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q [actual=%q]",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	evaluated := testEval(`"Hello World!"`)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String [actual=%T (%+v)]", evaluated, evaluated)
+	}
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value [actual=%q]", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	evaluated := testEval(`let greet = fn(name) { "Hello" + ", " + name + "!" }; greet("World")`)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String [actual=%T (%+v)]", evaluated, evaluated)
+	}
+	if str.Value != "Hello, World!" {
+		t.Errorf("String has wrong value [actual=%q]", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"abc" < "abd"`, true},
+		{`"b" > "abc"`, true},
+		{`"" < "a"`, true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArithmeticOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 7 % 3},
+		{"-7 % 3", -7 % 3},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"1 + 2 * 3 % 4", 3},
+		{"7 % 0", "division by zero: 7 % 0"},
+		{"7.5 % 0", "division by zero: 7.5 % 0"},
+		{"true % 2", "type mismatch: BOOLEAN % INTEGER"},
+		{`"a" ** "b"`, "unknown operator: STRING ** STRING"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{"7.5 % 2", 1.5},
+		{"2 ** -1", 0.5},
+		{"4 ** 0.5", 2},
+		{"1.5 ** 2", 2.25},
+	}
+	for _, tt := range floats {
+		testFloatObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"12 & 10", 12 & 10},
+		{"12 | 10", 12 | 10},
+		{"12 ^ 10", 12 ^ 10},
+		{"~5", ^5},
+		{"~-1", 0},
+		{"1 << 10", 1024},
+		{"1024 >> 3", 128},
+		{"-16 >> 2", -4},
+		{"1 << 63", -1 << 63},
+		{"0xFF & 0x0F | 0x100", 0x10F},
+		{"1 << 2 + 1", 8},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"8 >> 64", "shift count too large: 8 >> 64"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"true | false", "unknown operator: BOOLEAN | BOOLEAN"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
+		{`"abc" <= "abd"`, true},
+		{`"b" >= "b"`, true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 0", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 < 3", true},
+		{"false && x", false},
+		{"true || x", true},
+		{"true && x", "identifier not found: x"},
+		{`let f = fn() { return undefinedCall(); }; 1 > 2 && f()`, false},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{`-"Hello"`, "unknown operator: -STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned [actual=%T(%+v)]", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q [actual=%q]",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval("[1, 2 * 2, 3 + 3]")
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array [actual=%T (%+v)]", evaluated, evaluated)
+	}
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements [actual=%d]", len(result.Elements))
+	}
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[[1, 2], [3, 4]][1][0]", 3},
+		{"let f = fn() { [7, 8] }; f()[1]", 8},
+		{"[1, 2, 3][3]", "index out of range: 3 (length 3)"},
+		{"[1, 2, 3][-4]", "index out of range: -4 (length 3)"},
+		{"[][0]", "index out of range: 0 (length 0)"},
+		{`[1]["a"]`, "array index must be INTEGER, got STRING"},
+		{"1[0]", "index operator not supported: INTEGER"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments: expected 1, got 2"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int64{1}},
+		{`let a = [1]; push(a, 2); a`, []int64{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let len = fn(x) { 42 }; len([1])`, 42},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+/* Checks ints, int64 arrays, nil (null) and strings (error messages) */
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float [actual=%T (%+v)]", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. expected=%g [actual=%g]",
+			expected, result.Value)
+		return false
+	}
+	return true
+}
+
+func testObject(t *testing.T, obj object.Object, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case nil:
+		return testNullObject(t, obj)
+	case string:
+		errObj, ok := obj.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error [actual=%T (%+v)]", obj, obj)
+			return false
+		}
+		if errObj.Message != expected {
+			t.Errorf("wrong error message. expected=%q [actual=%q]",
+				expected, errObj.Message)
+			return false
+		}
+	case []int64:
+		array, ok := obj.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array [actual=%T (%+v)]", obj, obj)
+			return false
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. expected=%d [actual=%d]",
+				len(expected), len(array.Elements))
+			return false
+		}
+		for i, el := range expected {
+			if !testIntegerObject(t, array.Elements[i], el) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash [actual=%T (%+v)]", evaluated, evaluated)
+	}
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs [actual=%d]", result.Len())
+	}
+	for _, pair := range expected {
+		value, ok := result.Get(pair.key)
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+		testIntegerObject(t, value, pair.value)
+	}
+	if result.Inspect() != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+		t.Errorf("wrong Inspect() [actual=%q]", result.Inspect())
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{1: 5}[true]`, nil},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+		{`{"name": "Monkey"}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+		{`{fn(x) { x }: 1}`, "unusable as hash key: FUNCTION"},
+		{`{"a": [1, 2]}["a"][1]`, 2},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`keys({"a": 1, 2: 2})`, "[a, 2]"},
+		{`values({"a": 1, 2: 2})`, "[1, 2]"},
+		{`put({"a": 1}, "b", 2)`, "{a: 1, b: 2}"},
+		{`put({"a": 1}, "a", 2)`, "{a: 2}"},
+		{`let h = {"a": 1}; put(h, "b", 2); h`, "{a: 1}"},
+		{`delete({"a": 1, "b": 2}, "a")`, "{b: 2}"},
+		{`delete({"a": 1}, "x")`, "{a: 1}"},
+		{`put({}, [1], 1)`, "ERROR: unusable as hash key: ARRAY"},
+		{`keys([1])`, "ERROR: argument to `keys` must be HASH, got ARRAY"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q [actual=%q]",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; let f = fn(n) { n + 1 }; while (i < 1) { let i = f(i); }; i", 1},
+		{"while (false) { 1 }", nil},
+		{"let sum = fn(n) { let total = 0; let i = 0; while (true) { if (i > n) { break; } let total = total + i; let i = i + 1; } total }; sum(100)", 5050},
+		{"let f = fn() { while (true) { return 7; } }; f()", 7},
+		{"while (x) { 1 }", "identifier not found: x"},
+		{"let i = 0; while (i < 3) { let i = i + 1; if (i < 3) { continue; } let done = i; }; done", 3},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+/* Long loops don't grow the Go stack the way recursion does */
+func TestLongLoop(t *testing.T) {
+	input := "let i = 0; while (i < 100000) { let i = i + 1; }; i"
+	testIntegerObject(t, testEval(input), 100000)
+}
+
+/* Recursion stops with an error before it overflows the Go stack */
+func TestDeepRecursion(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(10000)"
+	testIntegerObject(t, testEval(input), 10000)
+
+	input = "let f = fn(n) { f(n + 1) }; f(0)"
+	testObject(t, testEval(input), "stack overflow")
+}
+
+/* A cancelled context stops loops and recursion */
+func TestCancellation(t *testing.T) {
+	inputs := []string{
+		"while (true) { }",
+		"for (x in [1, 2, 3]) { }",
+		"let f = fn() { 1 }; f()",
+	}
+	for _, input := range inputs {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		env := object.NewEnvironment()
+		env.SetContext(ctx)
+
+		code := parser.New(lexer.New(input)).ParseCode()
+		errObj, ok := Eval(code, env).(*object.Error)
+		if !ok {
+			t.Errorf("%s was not stopped", input)
+			continue
+		}
+		if errObj.Message != "evaluation stopped: context canceled" {
+			t.Errorf("wrong error message. expected=%q [actual=%q]",
+				"evaluation stopped: context canceled", errObj.Message)
+		}
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let total = 0; for (x in [1, 2, 3, 4]) { let total = total + x; }; total", 10},
+		{"for (x in [1, 2, 3]) { }; x", 3},
+		{"let f = fn(xs) { let r = 0; for (x in xs) { if (x == 3) { return x * 10; } } r }; f([1, 2, 3, 4])", 30},
+		{"let f = fn(xs) { let n = 0; for (x in xs) { if (x % 2 == 0) { continue; } if (x > 6) { break; } let n = n + x; } n }; f([1, 2, 3, 9, 5])", 4},
+		{`let f = fn(s) { let acc = []; for (c in s) { let acc = push(acc, c); } acc }; len(f("héllo"))`, 5},
+		{"for (x in 5) { x }", "not iterable: INTEGER"},
+		{"for (x in [1]) { y }", "identifier not found: y"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// hashes are iterated by key, in insertion order
+	input := `let keys = ""; for (k in {"b": 1, "a": 2}) { let keys = keys + k; }; keys`
+	if str, ok := testEval(input).(*object.String); !ok || str.Value != "ba" {
+		t.Errorf("expected keys in insertion order [actual=%s]", testEval(input).Inspect())
+	}
+}
+
+/* Signals in operands, arguments and elements end the expression */
+func TestLoopControlInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let s = []; for (x in [1, 2, 3]) { s = push(s, if (x == 2) { continue } else { x }) }; s", []int64{1, 3}},
+		{"let s = 0; for (x in [1, 2, 3]) { s = s + [100, if (x == 2) { break } else { x }][1] }; s", 1},
+		{"let s = 0; let i = 0; while (i < 5) { i += 1; s += -(if (i == 3) { continue } else { i }) }; s", -12},
+		{"let f = fn(a, b) { a + b }; let s = 0; for (x in [1, 2, 3]) { s += f(x, if (x == 2) { break } else { 1 }) }; s", 2},
+		{`let n = 0; for (x in [1, 2]) { let h = {if (x == 1) { continue } else { "k" }: x}; n += h["k"] }; n`, 2},
+		{"let i = 0; for (x in [1, 2, 3]) { while (if (x == 2) { break } else { false }) { }; i += x }; i", 1},
+		{"let f = fn(x) { let y = if (x) { return 1 } else { 2 }; y * 10 }; [f(true), f(false)]", []int64{1, 20}},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let a = 1; let b = 2; a = b = 5; a + b", 10},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let x = 1; let f = fn() { x = 5; }; f(); x", 5},
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; [f(), x]", []int64{3, 1}},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let i = 0; let total = 0; while (i < 5) { i += 1; total += i; }; total", 15},
+		{"y = 1", "assignment to undeclared identifier: y"},
+		{"let f = fn() { z = 1; }; f()", "assignment to undeclared identifier: z"},
+		{"len = 1", "assignment to undeclared identifier: len"},
+		{"x += 1", "identifier not found: x"},
+		{`let s = "a"; s -= "b"`, "unknown operator: STRING - STRING"},
+		{"let x = 1; x /= 0", "division by zero: 1 / 0"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// compound assignment follows the usual int/float promotion
+	testFloatObject(t, testEval("let x = 1; x += 0.5; x"), 1.5)
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a", []int64{10, 2, 3}},
+		{"let a = [1, 2, 3]; a[-1] += 5; a", []int64{1, 2, 8}},
+		{"let a = [1, 2]; let b = a; b[1] = 7; a", []int64{1, 7}},
+		{"let m = [[1], [2]]; m[1][0] *= 3; m[1][0]", 6},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`let h = {}; h["n"] = 0; for (x in [1, 2, 3]) { h["n"] += x; }; h["n"]`, 6},
+		{"let a = [1]; a[1] = 2", "index out of range: 1 (length 1)"},
+		{`let a = [1]; a["0"] = 2`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[fn(x) { x }] = 1", "unusable as hash key: FUNCTION"},
+		{`let h = {}; h["missing"] += 1`, "type mismatch: NULL + INTEGER"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	input := `let h = {"b": 1, "a": 2}; h["b"] = 3; h["c"] = 4; h`
+	if inspect := testEval(input).Inspect(); inspect != `{b: 3, a: 2, c: 4}` {
+		t.Errorf("updates should keep insertion order [actual=%s]", inspect)
+	}
+}
+
+func TestElseIfChains(t *testing.T) {
+	input := `let sign = fn(x) { if (x < 0) { -1 } else if (x == 0) { 0 } else { 1 } };
+	[sign(-5), sign(0), sign(7)]`
+	testObject(t, testEval(input), []int64{-1, 0, 1})
+
+	testNullObject(t, testEval("if (false) { 1 } else if (false) { 2 }"))
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 1 => 10, _ => 20 }`, 10},
+		{`match (2) { 1 => 10, _ => 20 }`, 20},
+		{`match (-3) { -3 => 1, _ => 0 }`, 1},
+		{`match (2.0) { 2 => 1, _ => 0 }`, 1},
+		{`match ("x") { "y" => 1, "x" => 2, _ => 3 }`, 2},
+		{`match (true) { 1 => 1, true => 2, _ => 3 }`, 2},
+		{`match (5) { n => n * 2 }`, 10},
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b, _ => 0 }`, 3},
+		{`match ([1, [2, 3]]) { [1, [_, c]] => c, _ => 0 }`, 3},
+		{`match ([1, 2, 3]) { [a, b] => 1, _ => 0 }`, 0},
+		{`match ({"x": 1, "y": 2}) { {"x": x, "y": y} => x + y, _ => 0 }`, 3},
+		{`match ({"x": 1}) { {"x": 2} => 1, {"z": z} => 2, {"x": _} => 3, _ => 4 }`, 3},
+		{`match ("s") { [a] => 1, {"a": a} => 2, _ => 3 }`, 3},
+		{`let a = 1; match ([5]) { [a] => a, _ => 0 }; a`, 1},
+		{`match (x) { _ => 1 }`, "identifier not found: x"},
+		{`match (1) { n => n + true }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
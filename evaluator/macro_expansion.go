@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"gomonkey/ast"
+	"gomonkey/object"
+)
+
+/*
+  Macros are expanded between parsing and evaluation:
+
+    DefineMacros(code, macroEnv)
+    expanded, err := ExpandMacros(code, macroEnv)
+    Eval(expanded, env)
+
+  macroEnv only holds macros, it can be kept around (eg. by the REPL) so
+  macros defined earlier stay available
+*/
+
+/*
+  Moves the top level 'let name = macro(...) {...};' statements out of
+  code and binds them in env. Macros defined anywhere else are left in
+  place and fail when evaluated
+*/
+func DefineMacros(code *ast.Code, env *object.Environment) {
+	statements := []ast.Statement{}
+
+	for _, statement := range code.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		macroLit, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		env.Set(let.Name.Value, &object.Macro{
+			Parameters: macroLit.Parameters,
+			Body:       macroLit.Body,
+			Env:        env,
+		})
+	}
+
+	code.Statements = statements
+}
+
+/*
+  Replaces every call to a macro with the code the macro returns. The
+  arguments are handed to the macro quoted, unevaluated. Returns the first
+  error a macro ran into, the expanded code is nil then
+*/
+func ExpandMacros(code ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	expanded := ast.Modify(code, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		macro, ok := macroFor(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = newError("wrong number of arguments: expected %d, got %d",
+				len(macro.Parameters), len(call.Arguments))
+			return node
+		}
+		evalEnv := object.NewEnclosedEnvironment(macro.Env)
+		for i, param := range macro.Parameters {
+			evalEnv.Set(param.Value, &object.Quote{Node: call.Arguments[i]})
+		}
+
+		evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+		switch result := evaluated.(type) {
+		case *object.Quote:
+			return result.Node
+		case *object.Error:
+			err = result
+		default:
+			err = newError("macro %s must return a quote, got %s",
+				call.Function.String(), typeOf(evaluated))
+		}
+		return node
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+func macroFor(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return obj.Type()
+}
@@ -0,0 +1,142 @@
+package evaluator
+
+import (
+	"gomonkey/ast"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"testing"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+	env := object.NewEnvironment()
+	code := testParseCode(input)
+
+	DefineMacros(code, env)
+
+	if len(code.Statements) != 2 {
+		t.Fatalf("wrong number of statements [actual=%d]", len(code.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro [actual=%T (%+v)]", obj, obj)
+	}
+	if len(macro.Parameters) != 2 || macro.Body.String() != "(x + y)" {
+		t.Errorf("wrong macro. [actual=%s]", macro.Inspect())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); };
+			infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+			reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`let unless = macro(cond, consequence, alternative) {
+				quote(if (!(unquote(cond))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`let twice = macro(x) { quote([unquote(x), unquote(x)]) };
+			let f = fn() { twice(1 + 1) };`,
+			`let f = fn() { [(1 + 1), (1 + 1)] };`,
+		},
+	}
+	for _, tt := range tests {
+		expected := testParseCode(tt.expected)
+		code := testParseCode(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(code, env)
+		expanded, err := ExpandMacros(code, env)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Message)
+			continue
+		}
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. expected=%q [actual=%q]", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestMacrosRunThroughEval(t *testing.T) {
+	input := `
+	let unless = macro(cond, consequence, alternative) {
+		quote(if (!(unquote(cond))) { unquote(consequence) } else { unquote(alternative) });
+	};
+	let x = 3;
+	unless(x > 5, "small", "big")`
+	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	code := testParseCode(input)
+	DefineMacros(code, macroEnv)
+	expanded, err := ExpandMacros(code, macroEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Message)
+	}
+
+	result, ok := Eval(expanded, env).(*object.String)
+	if !ok || result.Value != "small" {
+		t.Errorf("wrong result [actual=%+v]", result)
+	}
+}
+
+func TestMacroExpansionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro(x) { 1 }; m(2)`, "macro m must return a quote, got INTEGER"},
+		{`let m = macro(x) { quote(x) }; m(1, 2)`, "wrong number of arguments: expected 1, got 2"},
+		{`let m = macro() { quote(unquote(y)) }; m()`, "identifier not found: y"},
+	}
+	for _, tt := range tests {
+		code := testParseCode(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(code, env)
+		_, err := ExpandMacros(code, env)
+		if err == nil || err.Message != tt.expected {
+			t.Errorf("wrong error. expected=%q [actual=%v]", tt.expected, err)
+		}
+	}
+
+	evaluated := testEval(`let f = fn() { macro(x) { x } }; f()`)
+	testObject(t, evaluated, "macros can only be defined by a top level let statement")
+}
+
+func testParseCode(input string) *ast.Code {
+	p := parser.New(lexer.New(input))
+	return p.ParseCode()
+}
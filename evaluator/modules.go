@@ -0,0 +1,188 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* Environment variable listing the module directories, separated like $PATH */
+const MONKEYPATH = "MONKEYPATH"
+
+/* The directories in $MONKEYPATH, in order */
+func SearchPath() []string {
+	return filepath.SplitList(os.Getenv(MONKEYPATH))
+}
+
+/*
+  The module loader used by import statements. A module is evaluated the
+  first time it is imported, later imports of the same file get the same
+  *object.Module back. Paths are looked up relative to the importing file
+  (BaseDir for the top level code) and then in each SearchPath directory
+*/
+type Importer struct {
+	BaseDir    string   // where top level imports start from, "" is the working directory
+	SearchPath []string // extra directories, eg. SearchPath()
+
+	// Runs the code of each module, nil means the tree-walking evaluator
+	Run ModuleRunner
+
+	modules map[string]*object.Module // by absolute file name
+	loading []importFrame             // modules being evaluated, innermost last
+	ctx     context.Context
+}
+
+/*
+  Runs the code of a module, its macros already expanded, and returns the
+  values of the exported names. The importer is the one to use for the
+  imports of the module itself
+*/
+type ModuleRunner func(code *ast.Code, exports []string, importer *Importer) (map[string]object.Object, *object.Error)
+
+type importFrame struct {
+	path string // as written in the import statement
+	file string // absolute file name
+}
+
+func NewImporter(searchPath []string) *Importer {
+	return &Importer{SearchPath: searchPath, modules: map[string]*object.Module{}}
+}
+
+/*
+  The code of the modules, also when their functions are called later,
+  stops once ctx is done, like the code that imports them
+*/
+func (im *Importer) SetContext(ctx context.Context) {
+	im.ctx = ctx
+}
+
+func (im *Importer) Context() context.Context {
+	return im.ctx
+}
+
+func (im *Importer) Import(path string) object.Object {
+	file, searched := im.resolve(path)
+	if file == "" {
+		return newError("module not found: %q (searched %s)", path, strings.Join(searched, ", "))
+	}
+
+	for i, frame := range im.loading {
+		if frame.file == file {
+			return newError("import cycle: %s", im.cycle(i, path))
+		}
+	}
+
+	if module, ok := im.modules[file]; ok {
+		return module
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return newError("cannot read module %q: %s", path, err)
+	}
+
+	im.loading = append(im.loading, importFrame{path: path, file: file})
+	defer func() { im.loading = im.loading[:len(im.loading)-1] }()
+
+	result := im.evalModule(path, string(src))
+	if module, ok := result.(*object.Module); ok {
+		im.modules[file] = module
+	}
+	return result
+}
+
+/* Returns the absolute file name, or "" and the directories that were tried */
+func (im *Importer) resolve(path string) (string, []string) {
+	dirs := []string{}
+	if filepath.IsAbs(path) {
+		dirs = append(dirs, "")
+	} else if len(im.loading) > 0 {
+		dirs = append(dirs, filepath.Dir(im.loading[len(im.loading)-1].file))
+	} else if im.BaseDir != "" {
+		dirs = append(dirs, im.BaseDir)
+	} else {
+		dirs = append(dirs, ".")
+	}
+	dirs = append(dirs, im.SearchPath...)
+
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, path)
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if abs, err := filepath.Abs(candidate); err == nil {
+			return abs, nil
+		}
+	}
+	return "", dirs
+}
+
+/* "a.monkey" -> "b.monkey" -> "a.monkey", from the module at index start */
+func (im *Importer) cycle(start int, path string) string {
+	chain := []string{}
+	for _, frame := range im.loading[start:] {
+		chain = append(chain, fmt.Sprintf("%q", frame.path))
+	}
+	chain = append(chain, fmt.Sprintf("%q", path))
+	return strings.Join(chain, " -> ")
+}
+
+/* Parses the module, expands its macros and hands it to the runner */
+func (im *Importer) evalModule(path, src string) object.Object {
+	p := parser.New(lexer.New(src))
+	code := p.ParseCode()
+	if err := p.Errors().Err(); err != nil {
+		return newError("in module %q: %s", path, err)
+	}
+
+	macroEnv := object.NewEnvironment()
+	DefineMacros(code, macroEnv)
+	expanded, errObj := ExpandMacros(code, macroEnv)
+	if errObj != nil {
+		return newError("in module %q: %s", path, errObj.Message)
+	}
+
+	exports := []string{}
+	for _, statement := range code.Statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			exports = append(exports, export.Statement.Name.Value)
+		}
+	}
+
+	run := im.Run
+	if run == nil {
+		run = evalModuleCode
+	}
+	values, errObj := run(expanded.(*ast.Code), exports, im)
+	if errObj != nil {
+		return newError("in module %q: %s", path, errObj.Message)
+	}
+	return &object.Module{Path: path, Exports: values}
+}
+
+/*
+  Runs the module in a scope of its own, it shares nothing with the
+  importer but the Importer itself
+*/
+func evalModuleCode(code *ast.Code, exports []string, importer *Importer) (map[string]object.Object, *object.Error) {
+	env := object.NewEnvironment()
+	env.SetLoader(importer)
+	if errObj, ok := Eval(code, env).(*object.Error); ok {
+		return nil, errObj
+	}
+
+	values := map[string]object.Object{}
+	for _, name := range exports {
+		if value, ok := env.Get(name); ok {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,149 @@
+package evaluator
+
+import (
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/* Writes name -> source files below a temporary directory */
+func writeModules(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testEvalWithImporter(input string, importer *Importer) (object.Object, *object.Environment) {
+	p := parser.New(lexer.New(input))
+	code := p.ParseCode()
+	env := object.NewEnvironment()
+	env.SetLoader(importer)
+	return Eval(code, env), env
+}
+
+func TestImports(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/math.monkey": `
+			let square = fn(x) { x * x };
+			export let cube = fn(x) { square(x) * x };
+			export let answer = 42;`,
+		"lib/twice.monkey": `
+			import "math.monkey" as m;
+			export let sixth = fn(x) { m.cube(x) * m.cube(x) };`,
+		"broken.monkey":  `export let x = ;`,
+		"failing.monkey": `export let x = 1 + true;`,
+	})
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib/math.monkey" as m; m.answer`, 42},
+		{`import "lib/math.monkey" as m; m.cube(3)`, 27},
+		{`import "lib/twice.monkey" as t; t.sixth(2)`, 64},
+		{`import "lib/math.monkey" as m; m.square(3)`,
+			`module "lib/math.monkey" does not export square`},
+		{`let x = 1; x.y`, "member access not supported: INTEGER"},
+		{`import "missing.monkey" as m; 1`, `module not found: "missing.monkey" (searched ` + dir + `)`},
+		{`import "broken.monkey" as b; 1`,
+			`in module "broken.monkey": 1:16: expected expression, found ';'`},
+		{`import "failing.monkey" as f; 1`,
+			`in module "failing.monkey": type mismatch: INTEGER + BOOLEAN`},
+	}
+	for _, tt := range tests {
+		importer := NewImporter(nil)
+		importer.BaseDir = dir
+		result, _ := testEvalWithImporter(tt.input, importer)
+		testObject(t, result, tt.expected)
+	}
+}
+
+func TestModulesAreEvaluatedOnce(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"state.monkey": `export let counter = [0];`,
+		"user.monkey":  `import "state.monkey" as s; s.counter[0] += 1; export let seen = s.counter[0];`,
+	})
+	input := `
+	import "state.monkey" as a;
+	import "./state.monkey" as b;
+	import "user.monkey" as u;
+	a.counter[0] += 10;
+	[b.counter[0], u.seen]`
+	importer := NewImporter(nil)
+	importer.BaseDir = dir
+	result, env := testEvalWithImporter(input, importer)
+	testObject(t, result, []int64{11, 1})
+
+	a, _ := env.Get("a")
+	b, _ := env.Get("b")
+	if a != b {
+		t.Errorf("importing the same file twice gave two modules")
+	}
+	if a.Inspect() != "<module state.monkey>" {
+		t.Errorf("module.Inspect() wrong [actual=%q]", a.Inspect())
+	}
+}
+
+func TestImportCycles(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.monkey":    `import "b.monkey" as b; export let x = 1;`,
+		"b.monkey":    `import "a.monkey" as a; export let y = 2;`,
+		"self.monkey": `import "self.monkey" as me;`,
+	})
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "a.monkey" as a;`, `in module "a.monkey": in module "b.monkey": ` +
+			`import cycle: "a.monkey" -> "b.monkey" -> "a.monkey"`},
+		{`import "self.monkey" as s;`,
+			`in module "self.monkey": import cycle: "self.monkey" -> "self.monkey"`},
+	}
+	for _, tt := range tests {
+		importer := NewImporter(nil)
+		importer.BaseDir = dir
+		result, _ := testEvalWithImporter(tt.input, importer)
+		testObject(t, result, tt.expected)
+	}
+}
+
+func TestImportSearchPath(t *testing.T) {
+	local := writeModules(t, map[string]string{"shared.monkey": `export let where = 1;`})
+	first := writeModules(t, map[string]string{"shared.monkey": `export let where = 2;`})
+	second := writeModules(t, map[string]string{
+		"shared.monkey": `export let where = 3;`,
+		"only.monkey":   `export let where = 3;`,
+	})
+	t.Setenv(MONKEYPATH, first+string(os.PathListSeparator)+second)
+
+	tests := []struct {
+		input    string
+		baseDir  string
+		expected int
+	}{
+		{`import "shared.monkey" as s; s.where`, local, 1},
+		{`import "shared.monkey" as s; s.where`, t.TempDir(), 2},
+		{`import "only.monkey" as s; s.where`, local, 3},
+	}
+	for _, tt := range tests {
+		importer := NewImporter(SearchPath())
+		importer.BaseDir = tt.baseDir
+		result, _ := testEvalWithImporter(tt.input, importer)
+		testObject(t, result, tt.expected)
+	}
+}
+
+func TestImportWithoutLoader(t *testing.T) {
+	testObject(t, testEval(`import "a.monkey" as a;`),
+		`cannot import "a.monkey": no module loader configured`)
+}
@@ -0,0 +1,176 @@
+package evaluator
+
+import (
+	"gomonkey/ast"
+	"gomonkey/object"
+	"gomonkey/token"
+	"strconv"
+)
+
+/*
+  quote(exp) returns exp unevaluated, except for the unquote(x) calls in
+  it: x is evaluated right away and its value is spliced back in as code
+*/
+func quote(node ast.Node, env *object.Environment) object.Object {
+	if hasNestedUnquote(node) {
+		return newError("unquote cannot be nested in another unquote")
+	}
+	var err *object.Error
+
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		if err != nil || !isCallTo(node, "unquote") {
+			return node
+		}
+		call := node.(*ast.CallExpression)
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments: expected 1, got %d", len(call.Arguments))
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if unquoted == nil {
+			unquoted = NULL
+		}
+		if errObj, ok := unquoted.(*object.Error); ok {
+			err = errObj
+			return node
+		}
+		converted, ok := convertObjectToASTNode(unquoted)
+		if !ok {
+			err = newError("cannot unquote %s", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+/*
+  quote for the bytecode VM, which has computed the unquoted values
+  already: they replace the unquote(...) calls in node, in the order
+  ast.Modify visits the calls
+*/
+func QuoteWith(node ast.Node, values []object.Object) object.Object {
+	if hasNestedUnquote(node) {
+		return newError("unquote cannot be nested in another unquote")
+	}
+	var err *object.Error
+	next := 0
+
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		if err != nil || !isCallTo(node, "unquote") || next == len(values) {
+			return node
+		}
+		unquoted := values[next]
+		next++
+		if unquoted == nil {
+			unquoted = NULL
+		}
+		converted, ok := convertObjectToASTNode(unquoted)
+		if !ok {
+			err = newError("cannot unquote %s", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+/*
+  Whether an unquote call is inside the argument of another one. The code
+  the inner one splices in would need the scope of the quote to run, the
+  VM has none at that point, so both backends refuse it
+*/
+func hasNestedUnquote(node ast.Node) bool {
+	nested := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if nested || !isCallTo(n, "unquote") {
+			return !nested
+		}
+		for _, arg := range n.(*ast.CallExpression).Arguments {
+			ast.Inspect(arg, func(n ast.Node) bool {
+				nested = nested || isCallTo(n, "unquote")
+				return !nested
+			})
+		}
+		return false
+	})
+	return nested
+}
+
+func isCallTo(node ast.Node, name string) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+/*
+  Turns a value back into code that evaluates to it. Quotes give back the
+  code they hold, functions, builtins and null have no literal form
+*/
+func convertObjectToASTNode(obj object.Object) (ast.Node, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: strconv.FormatInt(obj.Value, 10)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, true
+
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: obj.Inspect()}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}, true
+
+	case *object.Boolean:
+		t := token.Token{Type: token.FALS, Literal: "false"}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, true
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, true
+
+	case *object.Array:
+		array := &ast.ArrayLiteral{Token: token.Token{Type: token.LBRK, Literal: "["}}
+		for _, element := range obj.Elements {
+			node, ok := convertObjectToASTNode(element)
+			if !ok {
+				return nil, false
+			}
+			array.Elements = append(array.Elements, node.(ast.Expression))
+		}
+		return array, true
+
+	case *object.Hash:
+		hash := &ast.HashLiteral{Token: token.Token{Type: token.LBRA, Literal: "{"}}
+		for _, pair := range obj.Pairs() {
+			key, ok := convertObjectToASTNode(pair.Key)
+			if !ok {
+				return nil, false
+			}
+			value, ok := convertObjectToASTNode(pair.Value)
+			if !ok {
+				return nil, false
+			}
+			hash.Pairs = append(hash.Pairs,
+				ast.HashPair{Key: key.(ast.Expression), Value: value.(ast.Expression)})
+		}
+		return hash, true
+
+	case *object.Quote:
+		return obj.Node, true
+
+	default:
+		return nil, false
+	}
+}
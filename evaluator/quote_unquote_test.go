@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"gomonkey/object"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(1.5 * 2))`, `3.0`},
+		{`quote(unquote("a" + "b"))`, `"ab"`},
+		{`quote(unquote([1, "x"]))`, `[1, "x"]`},
+		{`quote(unquote({"k": 1}))`, `{"k": 1}`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfix = quote(4 + 4); quote(unquote(4 + 4) + unquote(quotedInfix))`,
+			`(8 + (4 + 4))`},
+	}
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+/* Quoting doesn't change the function body, every call sees fresh values */
+func TestQuoteInFunctionBody(t *testing.T) {
+	input := `let q = fn(x) { quote(unquote(x) + 1) }; q(1); q(2)`
+	testQuoteObject(t, testEval(input), "(2 + 1)")
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(x))`, "identifier not found: x"},
+		{`quote(unquote(fn(x) { x }))`, "cannot unquote FUNCTION"},
+		{`quote(unquote(fn() {}()))`, "cannot unquote NULL"},
+		{`quote(unquote(1, 2))`, "wrong number of arguments: expected 1, got 2"},
+		{`quote(1, 2)`, "wrong number of arguments: expected 1, got 2"},
+		{`let y = 5; let x = quote(y); quote(unquote(unquote(x)))`, "unquote cannot be nested in another unquote"},
+		{`quote(unquote(puts(unquote(1))))`, "unquote cannot be nested in another unquote"},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testQuoteObject(t *testing.T, obj object.Object, expected string) bool {
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Errorf("object is not Quote [actual=%T (%+v)]", obj, obj)
+		return false
+	}
+	if quote.Node == nil {
+		t.Errorf("quote.Node is nil")
+		return false
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("wrong quoted code. expected=%q [actual=%q]", expected, quote.Node.String())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package lexer
+
+import (
+    "gomonkey/token"
+)
+
+/* Lexer options */
+type Mode uint
+
+const (
+    KeepTrivia  Mode = 1 << iota    // attach comments to tokens as token.Trivia
+)
+
+/*
+  Skips whitespace, line comments and block comments. Block comments
+  nest, so a commented out region may itself contain comments. Returns
+  the comments skipped over, or an ERR token when a block comment is
+  never closed
+*/
+func (l *Lexer) skipWhitespaceAndComments() ([]token.Comment, *token.Token) {
+    comments := []token.Comment{}
+    for {
+        l.skipWhitespace()
+        if l.curChar != '/' || (l.peek() != '/' && l.peek() != '*') {
+            return comments, nil
+        }
+        comment, ok := l.readComment()
+        if !ok {
+            return comments, &token.Token{Type: token.ERR,
+                Literal: comment.Text, Pos: comment.Pos}
+        }
+        comments = append(comments, comment)
+    }
+}
+
+/*
+  Comments following a token on the same line, eg.
+  let x = 5; // five
+  An unterminated block comment is returned as an ERR token, to be handed
+  out by the next call to NextToken
+*/
+func (l *Lexer) readTrailingComments() ([]token.Comment, *token.Token) {
+    comments := []token.Comment{}
+    for {
+        for l.curChar == ' ' || l.curChar == '\t' {
+            l.readChar()
+        }
+        if l.curChar != '/' || (l.peek() != '/' && l.peek() != '*') {
+            return comments, nil
+        }
+        comment, ok := l.readComment()
+        if !ok {
+            return comments, &token.Token{Type: token.ERR,
+                Literal: comment.Text, Pos: comment.Pos}
+        }
+        comments = append(comments, comment)
+    }
+}
+
+/* Called on the first '/' of a comment, returns false if it never ends */
+func (l *Lexer) readComment() (token.Comment, bool) {
+    start := l.currentPosition()
+    l.readChar()
+
+    if l.curChar == '/' {
+        for l.curChar != '\n' && l.curChar != '\r' && !l.atEnd() {
+            l.readChar()
+        }
+        return token.Comment{Text: l.input[start.Offset:l.position], Pos: start}, true
+    }
+
+    l.readChar()    // the '*'
+    depth := 1
+    for depth > 0 {
+        switch {
+        case l.atEnd():
+            l.addError(start, start, "unterminated block comment")
+            return token.Comment{Text: l.input[start.Offset:l.position], Pos: start}, false
+        case l.curChar == '/' && l.peek() == '*':
+            depth += 1
+            l.readChar()
+        case l.curChar == '*' && l.peek() == '/':
+            depth -= 1
+            l.readChar()
+        }
+        l.readChar()
+    }
+    return token.Comment{Text: l.input[start.Offset:l.position], Pos: start}, true
+}
@@ -0,0 +1,166 @@
+package lexer
+
+import (
+    "gomonkey/token"
+    "testing"
+)
+
+func TestCommentsAreSkipped(t *testing.T){
+    input := `// leading note
+let x = 10 / 2; // ten halved
+/* block */ let y /* inline */ = x;
+/* outer /* nested */ still outer */ y
+// last line`
+
+    tests := []struct{
+        expectedType    token.TokenType
+        expectedLiteral string
+    }{
+        {token.LET, "let"},
+        {token.IDN, "x"},
+        {token.AGMT, "="},
+        {token.INT, "10"},
+        {token.DIV, "/"},
+        {token.INT, "2"},
+        {token.SCLN, ";"},
+        {token.LET, "let"},
+        {token.IDN, "y"},
+        {token.AGMT, "="},
+        {token.IDN, "x"},
+        {token.SCLN, ";"},
+        {token.IDN, "y"},
+        {token.EOF, ""},
+    }
+
+    l := New(input)
+    for i, tt := range tests {
+        tok := l.NextToken()
+        if tok.Type != tt.expectedType {
+            t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+                i, tt.expectedType, tok.Type)
+        }
+        if tok.Literal != tt.expectedLiteral {
+            t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+                i, tt.expectedLiteral, tok.Literal)
+        }
+        if tok.Trivia != nil {
+            t.Fatalf("tests[%d] - trivia kept without KeepTrivia", i)
+        }
+    }
+}
+
+func TestUnterminatedBlockComment(t *testing.T){
+    tests := []struct{
+        input   string
+        mode    Mode
+    }{
+        {"let x = 1; /* never /* closed */", 0},
+        {"let x = 1; /* never /* closed */", KeepTrivia},
+    }
+
+    for i, tt := range tests {
+        l := NewWithMode(tt.input, tt.mode)
+        var tok token.Token
+        for tok = l.NextToken(); tok.Type != token.ERR && tok.Type != token.EOF; tok = l.NextToken() {
+        }
+        if tok.Type != token.ERR || tok.Literal != "/* never /* closed */" {
+            t.Fatalf("tests[%d] - expected ERR token for the comment, got=%q %q",
+                i, tok.Type, tok.Literal)
+        }
+        if eof := l.NextToken(); eof.Type != token.EOF {
+            t.Fatalf("tests[%d] - expected EOF after the comment, got=%q", i, eof.Type)
+        }
+        if len(l.Errors()) != 1 || l.Errors()[0].Error() != "1:12: unterminated block comment" {
+            t.Fatalf("tests[%d] - wrong errors %v", i, l.Errors())
+        }
+    }
+}
+
+func TestCommentTrivia(t *testing.T){
+    input := "// about x\n/* really */ let x = 1; // one\nx /* a */ /* b */\n// the end"
+
+    type expectedTrivia struct{
+        literal     string
+        leading     []string
+        trailing    []string
+    }
+    tests := []expectedTrivia{
+        {"let", []string{"// about x", "/* really */"}, nil},
+        {"x", nil, nil},
+        {"=", nil, nil},
+        {"1", nil, nil},
+        {";", nil, []string{"// one"}},
+        {"x", nil, []string{"/* a */", "/* b */"}},
+        {"", []string{"// the end"}, nil},
+    }
+
+    l := NewWithMode(input, KeepTrivia)
+    for i, tt := range tests {
+        tok := l.NextToken()
+        if tok.Literal != tt.literal {
+            t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.literal, tok.Literal)
+        }
+        if tt.leading == nil && tt.trailing == nil {
+            if tok.Trivia != nil {
+                t.Fatalf("tests[%d] - unexpected trivia %+v", i, tok.Trivia)
+            }
+            continue
+        }
+        if tok.Trivia == nil {
+            t.Fatalf("tests[%d] - trivia missing", i)
+        }
+        checkComments(t, i, "leading", tok.Trivia.Leading, tt.leading)
+        checkComments(t, i, "trailing", tok.Trivia.Trailing, tt.trailing)
+    }
+}
+
+/* Putting tokens and their comments back at their offsets gives the source */
+func TestTriviaRebuildsSource(t *testing.T){
+    input := "/* header */\nlet add = fn(a, b) { // adds\n  a + b /* sum */\n};\n// bye\n"
+
+    rebuilt := []byte{}
+    for i := range input {
+        if isWhitespace(rune(input[i])) {
+            rebuilt = append(rebuilt, input[i])
+        } else {
+            rebuilt = append(rebuilt, ' ')
+        }
+    }
+    place := func(text string, pos token.Position) {
+        copy(rebuilt[pos.Offset:], text)
+    }
+
+    l := NewWithMode(input, KeepTrivia)
+    for {
+        tok := l.NextToken()
+        if tok.Trivia != nil {
+            for _, c := range tok.Trivia.Leading {
+                place(c.Text, c.Pos)
+            }
+            for _, c := range tok.Trivia.Trailing {
+                place(c.Text, c.Pos)
+            }
+        }
+        if tok.Type == token.EOF {
+            break
+        }
+        place(tok.Literal, tok.Pos)
+    }
+
+    if string(rebuilt) != input {
+        t.Fatalf("rebuilt source differs.\nexpected=%q\ngot=%q", input, string(rebuilt))
+    }
+}
+
+func checkComments(t *testing.T, i int, kind string, actual []token.Comment, expected []string){
+    if len(actual) != len(expected) {
+        t.Fatalf("tests[%d] - wrong number of %s comments. expected=%d, got=%d",
+            i, kind, len(expected), len(actual))
+    }
+    for j, text := range expected {
+        if actual[j].Text != text {
+            t.Fatalf("tests[%d] - %s comment wrong. expected=%q, got=%q",
+                i, kind, text, actual[j].Text)
+        }
+    }
+}
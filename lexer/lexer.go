@@ -1,51 +1,125 @@
 package lexer
 
 import (
- //   "fmt"
-	"gomonkey/token"
+    "fmt"
+    "gomonkey/token"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
 )
 
+/*
+  The input is decoded as UTF-8, curChar is a whole character (rune).
+  position and readPtr are byte offsets into input
+*/
 type Lexer struct{
     input       string
     position    int
     readPtr     int
-    curChar     byte
+    curChar     rune
+
+    runeOffset  int     // number of runes before curChar
+    line        int     // line of curChar, 1-based
+    column      int     // column of curChar in runes, 1-based
+
+    mode        Mode
+    pending     *token.Token    // ERR token found while reading trivia
+    errors      []Error
+}
+
+/* Problems found while scanning, the offending token is returned as ERR */
+type Error struct{
+    Pos     token.Position
+    Msg     string
+
+    tokenOffset int     // start of the ERR token the error belongs to
+}
+
+func (e Error) Error() string {
+    return e.Pos.String() + ": " + e.Msg
 }
 
 
 func  New(code string) *Lexer{
-    l := &Lexer{input : code}
+    return NewWithMode(code, 0)
+}
+
+func NewWithMode(code string, mode Mode) *Lexer{
+    l := &Lexer{input : code, line: 1, runeOffset: -1, mode: mode}
     l.readChar()
     return l
 }
 
 func (l *Lexer) readChar(){
+    if l.readPtr > len(l.input) {
+        return  // already sitting on the end of the input
+    }
+
+    // Leaving a line break moves us to the start of the next line.
+    // "\r\n" counts as a single break, so the '\r' is skipped over here
+    if l.curChar == '\n' || (l.curChar == '\r' && l.peek() != '\n') {
+        l.line += 1
+        l.column = 0
+    }
+    l.column += 1
+    l.runeOffset += 1
+
+    width := 1
     if l.readPtr >= len(l.input){
         l.curChar = 0   //ASCII = NUL
     } else {
-        l.curChar = l.input[l.readPtr]
+        l.curChar, width = utf8.DecodeRuneInString(l.input[l.readPtr:])
     }
     l.position = l.readPtr
-    l.readPtr += 1
+    l.readPtr += width
 }
 
 
+/*
+  Whitespace and comments are skipped before every token. With KeepTrivia
+  the comments are attached to the token instead of being thrown away
+*/
 func (l *Lexer) NextToken() token.Token {
-    var tok token.Token
+    if l.pending != nil {
+        tok := *l.pending
+        l.pending = nil
+        return tok
+    }
+
+    leading, errTok := l.skipWhitespaceAndComments()
+    if errTok != nil {
+        return *errTok
+    }
+
+    tok := l.scanToken()
+
+    if l.mode&KeepTrivia != 0 {
+        trailing := []token.Comment{}
+        if tok.Type != token.EOF {
+            trailing, l.pending = l.readTrailingComments()
+        }
+        if len(leading) > 0 || len(trailing) > 0 {
+            tok.Trivia = &token.Trivia{Leading: leading, Trailing: trailing}
+        }
+    }
+    return tok
+}
 
-    l.skipWhitespace()
+func (l *Lexer) scanToken() token.Token {
+    var tok token.Token
+    pos := l.currentPosition()
+    errCount := len(l.errors)
 
     switch l.curChar {
     case '=':
-        if l.peek() == '=' {
-            tok = token.Token{Type: token.EQ, 
-                  Literal: string(l.curChar) + string(l.input[l.readPtr])}
-            l.readChar();
-        } else {
-            tok = newToken(token.AGMT, l.curChar)
-        }
+        tok = l.oneOrTwoChars(token.AGMT, twoChars{'=': token.EQ, '>': token.ARROW})
     case ';':
         tok = newToken(token.SCLN, l.curChar)
+    case ':':
+        tok = newToken(token.CLN, l.curChar)
+    case '.':
+        tok = newToken(token.DOT, l.curChar)
     case '(':
         tok = newToken(token.LPAR, l.curChar)
     case ')':
@@ -53,58 +127,233 @@ func (l *Lexer) NextToken() token.Token {
     case ',':
         tok = newToken(token.COM, l.curChar)
     case '+':
-        tok = newToken(token.PLUS, l.curChar)
+        tok = l.oneOrTwoChars(token.PLUS, twoChars{'=': token.PLUSEQ})
     case '{':
         tok = newToken(token.LBRA, l.curChar)
     case '}':
         tok = newToken(token.RBRA, l.curChar)
+    case '[':
+        tok = newToken(token.LBRK, l.curChar)
+    case ']':
+        tok = newToken(token.RBRK, l.curChar)
     case '-':
-        tok = newToken(token.MINS, l.curChar)
+        tok = l.oneOrTwoChars(token.MINS, twoChars{'=': token.MINSEQ})
     case '>':
-        tok = newToken(token.GT, l.curChar)
+        tok = l.oneOrTwoChars(token.GT, twoChars{'=': token.GTE, '>': token.SHR})
     case '<':
-        tok = newToken(token.LT, l.curChar)
+        tok = l.oneOrTwoChars(token.LT, twoChars{'=': token.LTE, '<': token.SHL})
     case '*':
-        tok = newToken(token.ASTK, l.curChar)
+        tok = l.oneOrTwoChars(token.ASTK, twoChars{'*': token.POW, '=': token.ASTKEQ})
+    case '%':
+        tok = newToken(token.MOD, l.curChar)
+    case '&':
+        tok = l.oneOrTwoChars(token.BAND, twoChars{'&': token.AND})
+    case '|':
+        tok = l.oneOrTwoChars(token.BOR, twoChars{'|': token.OR})
+    case '^':
+        tok = newToken(token.XOR, l.curChar)
+    case '~':
+        tok = newToken(token.TILDE, l.curChar)
     case '!':
         if l.peek() == '=' {
-            tok = token.Token{Type: token.NEQ, 
-                  Literal: string(l.curChar) + string(l.input[l.readPtr])}
+            tok = token.Token{Type: token.NEQ, Literal: "!="}
             l.readChar();
         } else {
             tok = newToken(token.BANG, l.curChar)
         }
     case '/':
-        tok = newToken(token.DIV, l.curChar)
+        tok = l.oneOrTwoChars(token.DIV, twoChars{'=': token.DIVEQ})
+    case '"':
+        return l.readString(pos)
     case 0:
+        if !l.atEnd() {
+            tok = newToken(token.ERR, l.curChar)
+            l.addError(pos, pos, "illegal character NUL")
+            break
+        }
         tok.Literal = ""
         tok.Type = token.EOF
     default:
-        if isLetter(l.curChar){
-            tok.Literal = l.readWithPredicate(isLetter)
+        if l.invalidEncoding() {
+            tok = token.Token{Type: token.ERR, Literal: l.input[l.position:l.readPtr]}
+            l.addError(pos, pos, "invalid UTF-8 encoding")
+        } else if isLetter(l.curChar){
+            tok.Literal = l.readWithPredicate(isIdentifierChar)
             tok.Type = token.IdentifierLookup(tok.Literal)
+            tok.Pos = pos
             return tok
         } else if isDigit(l.curChar){
-            tok.Literal = l.readWithPredicate(isDigit)
-            tok.Type = token.INT
-            return tok
+            return l.readNumber(pos)
         }else{
             tok = newToken(token.ERR, l.curChar)
         }
     }
+    if tok.Type == token.ERR && len(l.errors) == errCount {
+        l.addError(pos, pos, fmt.Sprintf("illegal character %q", l.curChar))
+    }
+    tok.Pos = pos
     l.readChar()
     return tok
 }
 
-type predicate func(byte) bool
+/* Second character of an operator -> type of the two character token */
+type twoChars map[rune]token.TokenType
+
+/*
+  Operators that may be followed by a second character, eg. '<', '<=' and
+  '<<'. Leaves curChar on the last character of the token
+*/
+func (l *Lexer) oneOrTwoChars(one token.TokenType, two twoChars) token.Token {
+    if tokType, ok := two[l.peek()]; ok {
+        first := l.curChar
+        l.readChar()
+        return token.Token{Type: tokType, Literal: string(first) + string(l.curChar)}
+    }
+    return newToken(one, l.curChar)
+}
+
+/* Errors reported so far, in the order they were found */
+func (l *Lexer) Errors() []Error {
+    return l.errors
+}
 
-func isLetter(input byte) bool {
-    return input >= 'a' && input <= 'z' || 
-           input >= 'A' && input <= 'Z' || 
-           input == '_'
+/* The error reported for the ERR token starting at pos, if any */
+func (l *Lexer) ErrorAt(pos token.Position) (Error, bool) {
+    for _, err := range l.errors {
+        if err.tokenOffset == pos.Offset {
+            return err, true
+        }
+    }
+    return Error{}, false
 }
 
-func isDigit(input byte) bool {
+func (l *Lexer) addError(tok token.Position, pos token.Position, msg string) {
+    l.errors = append(l.errors, Error{Pos: pos, Msg: msg, tokenOffset: tok.Offset})
+}
+
+func (l *Lexer) atEnd() bool {
+    return l.position >= len(l.input)
+}
+
+/* curChar is a byte that doesn't start a valid UTF-8 sequence */
+func (l *Lexer) invalidEncoding() bool {
+    return l.curChar == utf8.RuneError && l.readPtr - l.position == 1
+}
+
+/*
+  String literals, the literal of the token is the decoded value.
+  Supported escapes: \n \t \r \" \\ and \u{XXXX} (1 to 6 hex digits).
+  A bad escape or a missing closing quote turns the whole string into an
+  ERR token, only the first problem in a string is reported
+*/
+func (l *Lexer) readString(start token.Position) token.Token {
+    var out strings.Builder
+    failed := false
+    fail := func(pos token.Position, msg string) {
+        if !failed {
+            l.addError(start, pos, msg)
+            failed = true
+        }
+    }
+
+    l.readChar()   // opening quote
+    for l.curChar != '"' {
+        if l.atEnd() {
+            fail(start, "unterminated string literal")
+            return token.Token{Type: token.ERR,
+                Literal: l.input[start.Offset:l.position], Pos: start}
+        }
+        if l.invalidEncoding() {
+            fail(l.currentPosition(), "invalid UTF-8 encoding in string literal")
+        }
+        if l.curChar != '\\' {
+            out.WriteRune(l.curChar)
+            l.readChar()
+            continue
+        }
+
+        escPos := l.currentPosition()
+        l.readChar()
+        switch l.curChar {
+        case 'n':
+            out.WriteByte('\n')
+        case 't':
+            out.WriteByte('\t')
+        case 'r':
+            out.WriteByte('\r')
+        case '"':
+            out.WriteByte('"')
+        case '\\':
+            out.WriteByte('\\')
+        case 'u':
+            r, ok := l.readUnicodeEscape()
+            if !ok {
+                fail(escPos, "invalid unicode escape, expected \\u{XXXX}")
+                continue
+            }
+            out.WriteRune(r)
+        default:
+            if l.atEnd() {
+                continue
+            }
+            fail(escPos, fmt.Sprintf("unknown escape sequence \\%c", l.curChar))
+        }
+        l.readChar()
+    }
+    l.readChar()   // closing quote
+
+    if failed {
+        return token.Token{Type: token.ERR,
+            Literal: l.input[start.Offset:l.position], Pos: start}
+    }
+    return token.Token{Type: token.STRING, Literal: out.String(), Pos: start}
+}
+
+/* Called on the 'u' of an escape, leaves curChar on the closing '}' */
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+    if l.peek() != '{' {
+        return 0, false
+    }
+    l.readChar()
+    l.readChar()
+    startIdx := l.position
+    for isHexDigit(l.curChar) {
+        l.readChar()
+    }
+    digits := l.input[startIdx:l.position]
+    if l.curChar != '}' || len(digits) == 0 || len(digits) > 6 {
+        return 0, false
+    }
+    value, err := strconv.ParseUint(digits, 16, 32)
+    if err != nil || !utf8.ValidRune(rune(value)) {
+        return 0, false
+    }
+    return rune(value), true
+}
+
+func isHexDigit(input rune) bool {
+    return isDigit(input) || input >= 'a' && input <= 'f' || input >= 'A' && input <= 'F'
+}
+
+func (l *Lexer) currentPosition() token.Position {
+    return token.Position{Offset: l.position, RuneOffset: l.runeOffset,
+        Line: l.line, Column: l.column}
+}
+
+type predicate func(rune) bool
+
+/* Identifiers start with a letter of any script or '_' */
+func isLetter(input rune) bool {
+    return unicode.IsLetter(input) || input == '_'
+}
+
+/* ...and may continue with digits of any script */
+func isIdentifierChar(input rune) bool {
+    return isLetter(input) || unicode.IsDigit(input)
+}
+
+/* Number literals only use ASCII digits */
+func isDigit(input rune) bool {
     return (input >= '0' && input <= '9');
 }
 
@@ -116,23 +365,25 @@ func (l* Lexer) readWithPredicate(fn predicate) string {
     return l.input[startIdx:l.position]
 }
 
-func newToken(tokenType token.TokenType, char byte) token.Token {
+func newToken(tokenType token.TokenType, char rune) token.Token {
     return token.Token{Type: tokenType,Literal:  string(char)}
 }
 
 
 func (l *Lexer) skipWhitespace(){
-    for l.curChar == ' ' || 
-       l.curChar == '\n' || 
-       l.curChar == '\r' ||
-       l.curChar == '\t' { 
+    for isWhitespace(l.curChar) {
         l.readChar()
     }
 }
 
-func (l *Lexer) peek() byte {
+func isWhitespace(input rune) bool {
+    return input == ' ' || input == '\n' || input == '\r' || input == '\t'
+}
+
+func (l *Lexer) peek() rune {
     if l.readPtr < len(l.input){
-        return l.input[l.readPtr]
+        r, _ := utf8.DecodeRuneInString(l.input[l.readPtr:])
+        return r
     }
     return 0
 }
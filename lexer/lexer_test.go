@@ -7,7 +7,7 @@ import (
 
 func TestNextToken(t *testing.T){
     inputs := [...]string{`=+(){},;let`,
-                        `let five 5;
+                        `let five = 5;
                         let ten = 10;
 
                         let add = fn(x, y) {
@@ -15,7 +15,7 @@ func TestNextToken(t *testing.T){
                         };
 
                         let result = add(five, ten);
-                        !-/*5;
+                        !-/ *5;
                         5 < 10 > 5;
 
                         if (5 < 10) {
@@ -141,3 +141,229 @@ func TestNextToken(t *testing.T){
         }
     }
 }
+
+func TestTokenPositions(t *testing.T){
+    input := "let x = 5;\r\nx +\n  10\r\n\r\nfoo"
+
+    tests := []struct{
+        expectedLiteral string
+        expectedPos     token.Position
+    }{
+        {"let", token.Position{Offset: 0, RuneOffset: 0, Line: 1, Column: 1}},
+        {"x", token.Position{Offset: 4, RuneOffset: 4, Line: 1, Column: 5}},
+        {"=", token.Position{Offset: 6, RuneOffset: 6, Line: 1, Column: 7}},
+        {"5", token.Position{Offset: 8, RuneOffset: 8, Line: 1, Column: 9}},
+        {";", token.Position{Offset: 9, RuneOffset: 9, Line: 1, Column: 10}},
+        {"x", token.Position{Offset: 12, RuneOffset: 12, Line: 2, Column: 1}},
+        {"+", token.Position{Offset: 14, RuneOffset: 14, Line: 2, Column: 3}},
+        {"10", token.Position{Offset: 18, RuneOffset: 18, Line: 3, Column: 3}},
+        {"foo", token.Position{Offset: 24, RuneOffset: 24, Line: 5, Column: 1}},
+        {"", token.Position{Offset: 27, RuneOffset: 27, Line: 5, Column: 4}},
+    }
+
+    l := New(input)
+    for i, tt := range tests {
+        tok := l.NextToken()
+        if tok.Literal != tt.expectedLiteral {
+            t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+                i, tt.expectedLiteral, tok.Literal)
+        }
+        if tok.Pos != tt.expectedPos {
+            t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+                i, tt.expectedPos, tok.Pos)
+        }
+    }
+}
+
+func TestLoneCarriageReturnIsLineBreak(t *testing.T){
+    l := New("a\rb")
+    l.NextToken()
+    tok := l.NextToken()
+    if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+        t.Fatalf("position wrong. expected=2:1, got=%s", tok.Pos)
+    }
+}
+
+func TestStringLiterals(t *testing.T){
+    tests := []struct{
+        input           string
+        expectedType    token.TokenType
+        expectedLiteral string
+    }{
+        {`"foobar"`, token.STRING, "foobar"},
+        {`"foo bar"`, token.STRING, "foo bar"},
+        {`""`, token.STRING, ""},
+        {`"a\nb\tc\r"`, token.STRING, "a\nb\tc\r"},
+        {`"say \"hi\""`, token.STRING, `say "hi"`},
+        {`"back\\slash"`, token.STRING, `back\slash`},
+        {`"\u{41}\u{e9}\u{1F600}"`, token.STRING, "Aé😀"},
+        {"\"multi\nline\"", token.STRING, "multi\nline"},
+        {`"bad \q escape"`, token.ERR, `"bad \q escape"`},
+        {`"bad \u{110000}"`, token.ERR, `"bad \u{110000}"`},
+        {`"bad \u41"`, token.ERR, `"bad \u41"`},
+        {`"never closed`, token.ERR, `"never closed`},
+        {`"ends in \`, token.ERR, `"ends in \`},
+    }
+
+    for i, tt := range tests {
+        l := New(tt.input)
+        tok := l.NextToken()
+        if tok.Type != tt.expectedType {
+            t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+                i, tt.expectedType, tok.Type)
+        }
+        if tok.Literal != tt.expectedLiteral {
+            t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+                i, tt.expectedLiteral, tok.Literal)
+        }
+        if eof := l.NextToken(); eof.Type != token.EOF {
+            t.Fatalf("tests[%d] - string not fully consumed, got=%q", i, eof.Literal)
+        }
+    }
+}
+
+func TestLexerErrors(t *testing.T){
+    tests := []struct{
+        input       string
+        expected    string
+    }{
+        {"let s = \"abc;\nlet t = 1;", "1:9: unterminated string literal"},
+        {`"ok \z"`, `1:5: unknown escape sequence \z`},
+        {`"\u{zz}"`, `1:2: invalid unicode escape, expected \u{XXXX}`},
+        {"a @ b", "1:3: illegal character '@'"},
+    }
+
+    for i, tt := range tests {
+        l := New(tt.input)
+        for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+        }
+        if len(l.Errors()) != 1 {
+            t.Fatalf("tests[%d] - expected 1 error, got=%v", i, l.Errors())
+        }
+        if l.Errors()[0].Error() != tt.expected {
+            t.Fatalf("tests[%d] - error wrong. expected=%q, got=%q",
+                i, tt.expected, l.Errors()[0].Error())
+        }
+    }
+}
+
+func TestUnicodeIdentifiers(t *testing.T){
+    input := "let café = \"naïve\";\nlet 数字2 = café + ñ_1;\nΩ"
+
+    tests := []struct{
+        expectedType    token.TokenType
+        expectedLiteral string
+        expectedPos     token.Position
+    }{
+        {token.LET, "let", token.Position{Offset: 0, RuneOffset: 0, Line: 1, Column: 1}},
+        {token.IDN, "café", token.Position{Offset: 4, RuneOffset: 4, Line: 1, Column: 5}},
+        {token.AGMT, "=", token.Position{Offset: 10, RuneOffset: 9, Line: 1, Column: 10}},
+        {token.STRING, "naïve", token.Position{Offset: 12, RuneOffset: 11, Line: 1, Column: 12}},
+        {token.SCLN, ";", token.Position{Offset: 20, RuneOffset: 18, Line: 1, Column: 19}},
+        {token.LET, "let", token.Position{Offset: 22, RuneOffset: 20, Line: 2, Column: 1}},
+        {token.IDN, "数字2", token.Position{Offset: 26, RuneOffset: 24, Line: 2, Column: 5}},
+        {token.AGMT, "=", token.Position{Offset: 34, RuneOffset: 28, Line: 2, Column: 9}},
+        {token.IDN, "café", token.Position{Offset: 36, RuneOffset: 30, Line: 2, Column: 11}},
+        {token.PLUS, "+", token.Position{Offset: 42, RuneOffset: 35, Line: 2, Column: 16}},
+        {token.IDN, "ñ_1", token.Position{Offset: 44, RuneOffset: 37, Line: 2, Column: 18}},
+        {token.SCLN, ";", token.Position{Offset: 48, RuneOffset: 40, Line: 2, Column: 21}},
+        {token.IDN, "Ω", token.Position{Offset: 50, RuneOffset: 42, Line: 3, Column: 1}},
+        {token.EOF, "", token.Position{Offset: 52, RuneOffset: 43, Line: 3, Column: 2}},
+    }
+
+    l := New(input)
+    for i, tt := range tests {
+        tok := l.NextToken()
+        if tok.Type != tt.expectedType {
+            t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+                i, tt.expectedType, tok.Type)
+        }
+        if tok.Literal != tt.expectedLiteral {
+            t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+                i, tt.expectedLiteral, tok.Literal)
+        }
+        if tok.Pos != tt.expectedPos {
+            t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+                i, tt.expectedPos, tok.Pos)
+        }
+    }
+    if len(l.Errors()) != 0 {
+        t.Fatalf("unexpected errors %v", l.Errors())
+    }
+}
+
+func TestMultiByteIllegalCharacters(t *testing.T){
+    tests := []struct{
+        input       string
+        expected    []string
+    }{
+        {"a € b", []string{"1:3: illegal character '€'"}},
+        {"x \xff y", []string{"1:3: invalid UTF-8 encoding"}},
+        {"\"a\xffb\"", []string{"1:3: invalid UTF-8 encoding in string literal"}},
+        {"٣", []string{"1:1: illegal character '٣'"}},
+    }
+
+    for i, tt := range tests {
+        l := New(tt.input)
+        illegal := 0
+        for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+            if tok.Type == token.ERR {
+                illegal++
+            }
+        }
+        if illegal != len(tt.expected) {
+            t.Fatalf("tests[%d] - expected %d ERR tokens, got=%d", i, len(tt.expected), illegal)
+        }
+        for j, msg := range tt.expected {
+            if l.Errors()[j].Error() != msg {
+                t.Fatalf("tests[%d] - error wrong. expected=%q, got=%q",
+                    i, msg, l.Errors()[j].Error())
+            }
+        }
+    }
+}
+
+func TestOperators(t *testing.T){
+    input := `<= >= < > % ** * && || & | ^ ~ << >> <<= >>> += -= *= /= = == =>`
+    expected := []struct{
+        expectedType    token.TokenType
+        expectedLiteral string
+    }{
+        {token.LTE, "<="},
+        {token.GTE, ">="},
+        {token.LT, "<"},
+        {token.GT, ">"},
+        {token.MOD, "%"},
+        {token.POW, "**"},
+        {token.ASTK, "*"},
+        {token.AND, "&&"},
+        {token.OR, "||"},
+        {token.BAND, "&"},
+        {token.BOR, "|"},
+        {token.XOR, "^"},
+        {token.TILDE, "~"},
+        {token.SHL, "<<"},
+        {token.SHR, ">>"},
+        {token.SHL, "<<"},
+        {token.AGMT, "="},
+        {token.SHR, ">>"},
+        {token.GT, ">"},
+        {token.PLUSEQ, "+="},
+        {token.MINSEQ, "-="},
+        {token.ASTKEQ, "*="},
+        {token.DIVEQ, "/="},
+        {token.AGMT, "="},
+        {token.EQ, "=="},
+        {token.ARROW, "=>"},
+        {token.EOF, ""},
+    }
+
+    l := New(input)
+    for i, tt := range expected {
+        tok := l.NextToken()
+        if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+            t.Fatalf("tests[%d] - expected %s %q [actual=%s %q]",
+                i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+    }
+}
@@ -0,0 +1,112 @@
+package lexer
+
+import (
+    "fmt"
+    "gomonkey/token"
+)
+
+/*
+  Number literals
+    decimal     123, 1_000_000
+    prefixed    0x1F, 0o17, 0b1010 (upper case prefixes work as well)
+    float       1.5, 3e8, 6.02e+23, 1_000.25
+  '_' may only separate two digits, or follow a base prefix (0x_FF).
+  Prefixed literals are always integers
+*/
+func (l *Lexer) readNumber(pos token.Position) token.Token {
+    start := l.position
+    tokType := token.TokenType(token.INT)
+    kind := "decimal"
+    digitFn := isDigit
+
+    if l.curChar == '0' {
+        switch l.peek() {
+        case 'x', 'X':
+            kind, digitFn = "hexadecimal", isHexDigit
+        case 'o', 'O':
+            kind, digitFn = "octal", isOctalDigit
+        case 'b', 'B':
+            kind, digitFn = "binary", isBinaryDigit
+        }
+    }
+    prefixed := kind != "decimal"
+
+    if prefixed {
+        l.readChar()
+        l.readChar()
+    }
+    l.readDigits(digitFn)
+
+    if !prefixed {
+        if l.curChar == '.' && isDigit(l.peek()) {
+            tokType = token.FLOAT
+            l.readChar()
+            l.readDigits(isDigit)
+        }
+        if l.curChar == 'e' || l.curChar == 'E' {
+            tokType = token.FLOAT
+            l.readChar()
+            if l.curChar == '+' || l.curChar == '-' {
+                l.readChar()
+            }
+            if !isDigit(l.curChar) {
+                return l.numberError(pos, start, "exponent has no digits")
+            }
+            l.readDigits(isDigit)
+        }
+    }
+
+    // letters or digits of the wrong base stuck to the number, eg. 0b102
+    if isIdentifierChar(l.curChar) {
+        return l.numberError(pos, start,
+            fmt.Sprintf("invalid character %q in %s literal", l.curChar, kind))
+    }
+
+    literal := l.input[start:l.position]
+    if prefixed && len(literal) == 2 {
+        return l.numberError(pos, start, kind + " literal has no digits")
+    }
+    if !validUnderscores(literal, prefixed, digitFn) {
+        return l.numberError(pos, start, "'_' must separate successive digits")
+    }
+    return token.Token{Type: tokType, Literal: literal, Pos: pos}
+}
+
+func (l *Lexer) readDigits(fn predicate) {
+    for fn(l.curChar) || l.curChar == '_' {
+        l.readChar()
+    }
+}
+
+/* Skips the rest of the malformed literal and reports it as one ERR token */
+func (l *Lexer) numberError(pos token.Position, start int, msg string) token.Token {
+    for isIdentifierChar(l.curChar) {
+        l.readChar()
+    }
+    l.addError(pos, pos, msg)
+    return token.Token{Type: token.ERR, Literal: l.input[start:l.position], Pos: pos}
+}
+
+func validUnderscores(literal string, prefixed bool, digitFn predicate) bool {
+    for i := 0; i < len(literal); i++ {
+        if literal[i] != '_' {
+            continue
+        }
+        afterPrefix := prefixed && i == 2
+        if !afterPrefix && (i == 0 || !digitFn(rune(literal[i-1]))) {
+            return false
+        }
+        if i+1 >= len(literal) || !digitFn(rune(literal[i+1])) {
+            return false
+        }
+    }
+    return true
+}
+
+func isOctalDigit(input rune) bool {
+    return input >= '0' && input <= '7'
+}
+
+func isBinaryDigit(input rune) bool {
+    return input == '0' || input == '1'
+}
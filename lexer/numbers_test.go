@@ -0,0 +1,81 @@
+package lexer
+
+import (
+    "gomonkey/token"
+    "testing"
+)
+
+func TestNumberLiterals(t *testing.T){
+    tests := []struct{
+        input           string
+        expectedType    token.TokenType
+        expectedLiteral string
+    }{
+        {"0", token.INT, "0"},
+        {"1_000_000", token.INT, "1_000_000"},
+        {"0x1F", token.INT, "0x1F"},
+        {"0Xdead_beef", token.INT, "0Xdead_beef"},
+        {"0o17", token.INT, "0o17"},
+        {"0b1010_0101", token.INT, "0b1010_0101"},
+        {"0x_FF", token.INT, "0x_FF"},
+        {"1.5", token.FLOAT, "1.5"},
+        {"3e8", token.FLOAT, "3e8"},
+        {"6.02E+23", token.FLOAT, "6.02E+23"},
+        {"1e-9", token.FLOAT, "1e-9"},
+        {"1_000.25", token.FLOAT, "1_000.25"},
+    }
+
+    for i, tt := range tests {
+        l := New(tt.input)
+        tok := l.NextToken()
+        if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+            t.Fatalf("tests[%d] - expected %s %q [actual=%s %q]",
+                i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+        if next := l.NextToken(); next.Type != token.EOF {
+            t.Fatalf("tests[%d] - expected EOF after the number [actual=%q]", i, next.Literal)
+        }
+    }
+}
+
+/* A dot only starts a fraction when a digit follows it */
+func TestNumberFollowedByDot(t *testing.T){
+    l := New("1.foo")
+    expected := []token.TokenType{token.INT, token.DOT, token.IDN, token.EOF}
+    for i, tt := range expected {
+        tok := l.NextToken()
+        if tok.Type != tt {
+            t.Fatalf("tokens[%d] - expected %s [actual=%s]", i, tt, tok.Type)
+        }
+    }
+}
+
+func TestNumberLiteralErrors(t *testing.T){
+    tests := []struct{
+        input           string
+        expectedLiteral string
+        expected        string
+    }{
+        {"0b102", "0b102", "1:1: invalid character '2' in binary literal"},
+        {"0o8", "0o8", "1:1: invalid character '8' in octal literal"},
+        {"123abc", "123abc", "1:1: invalid character 'a' in decimal literal"},
+        {"0x", "0x", "1:1: hexadecimal literal has no digits"},
+        {"1e", "1e", "1:1: exponent has no digits"},
+        {"1e+", "1e+", "1:1: exponent has no digits"},
+        {"1__0", "1__0", "1:1: '_' must separate successive digits"},
+        {"10_", "10_", "1:1: '_' must separate successive digits"},
+        {"1_.5", "1_.5", "1:1: '_' must separate successive digits"},
+    }
+
+    for i, tt := range tests {
+        l := New(tt.input)
+        tok := l.NextToken()
+        if tok.Type != token.ERR || tok.Literal != tt.expectedLiteral {
+            t.Fatalf("tests[%d] - expected ERR %q [actual=%s %q]",
+                i, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+        if len(l.Errors()) != 1 || l.Errors()[0].Error() != tt.expected {
+            t.Fatalf("tests[%d] - expected error %q [actual=%v]", i, tt.expected, l.Errors())
+        }
+    }
+}
@@ -1,13 +1,82 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"gomonkey/compiler"
+	"gomonkey/optimizer"
 	"gomonkey/repl"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 )
 
+/* Names of the optimizer passes for -optimize */
+var optimizerPasses = map[string]optimizer.Pass{
+	"fold":        optimizer.FoldConstants,
+	"branches":    optimizer.FoldBranches,
+	"unreachable": optimizer.DropUnreachable,
+	"all":         optimizer.All,
+}
+
 func main() {
+	engine := flag.String("engine", string(repl.EVAL), "backend that runs the code: eval or vm")
+	output := flag.String("o", "", "compile the script to a bytecode `file` instead of running it")
+	trace := flag.Bool("trace", false, "log every instruction the VM runs to stderr")
+	optimize := flag.String("optimize", "", "comma separated optimizer `passes` to run: fold, branches, unreachable or all")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "usage: %s [-engine eval|vm] [-trace] [-optimize passes] [-o file] [script]\n", os.Args[0])
+		fmt.Fprintf(out, "       %s disasm script\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *engine != string(repl.EVAL) && *engine != string(repl.VM) {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, expected eval or vm\n", *engine)
+		os.Exit(2)
+	}
+	options := repl.Options{Engine: repl.Engine(*engine)}
+	if *trace {
+		if options.Engine != repl.VM && !isBytecodeFile(flag.Arg(0)) {
+			fmt.Fprintln(os.Stderr, "-trace needs -engine=vm")
+			os.Exit(2)
+		}
+		options.Trace = os.Stderr
+	}
+	if *optimize != "" {
+		for _, name := range strings.Split(*optimize, ",") {
+			pass, ok := optimizerPasses[strings.TrimSpace(name)]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "unknown optimizer pass %q, expected fold, branches, unreachable or all\n", name)
+				os.Exit(2)
+			}
+			options.Optimize |= pass
+		}
+	}
+
+	switch {
+	case flag.Arg(0) == "disasm":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		disassemble(flag.Arg(1), os.Stdout, options.Optimize)
+	case flag.NArg() > 0 && *output != "":
+		compileScript(flag.Arg(0), *output, options.Optimize)
+	case flag.NArg() > 0:
+		options.Dir = filepath.Dir(flag.Arg(0))
+		runScript(flag.Arg(0), options)
+	case *output != "":
+		fmt.Fprintln(os.Stderr, "-o needs a script to compile")
+		os.Exit(2)
+	default:
+		startREPL(options)
+	}
+}
+
+func startREPL(options repl.Options) {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,5 +84,81 @@ func main() {
 	fmt.Printf("Hello %s! This is the Monkey codeming language!\n",
 		user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.StartWithOptions(os.Stdin, os.Stdout, options)
+}
+
+/* Precompiled scripts always run on the VM */
+func runScript(path string, options repl.Options) {
+	src := readFile(path)
+
+	ok := false
+	if compiler.IsBytecode(src) {
+		ok = repl.RunBytecode(loadBytecode(path, src), os.Stdout, options)
+	} else {
+		ok = repl.RunProgram(string(src), os.Stdout, options)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func compileScript(path string, output string, passes optimizer.Pass) {
+	data, err := compileSource(path, readFile(path), passes).MarshalBinary()
+	if err != nil {
+		fail(fmt.Errorf("%s: %w", path, err))
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fail(err)
+	}
+}
+
+/* Works on source files and on precompiled ones */
+func disassemble(path string, out io.Writer, passes optimizer.Pass) {
+	src := readFile(path)
+	if compiler.IsBytecode(src) {
+		compiler.Disassemble(out, loadBytecode(path, src))
+	} else {
+		compiler.Disassemble(out, compileSource(path, src, passes))
+	}
+}
+
+func compileSource(path string, src []byte, passes optimizer.Pass) *compiler.Bytecode {
+	bytecode, ok := repl.CompileProgram(string(src), os.Stderr, passes)
+	if !ok {
+		os.Exit(1)
+	}
+	return bytecode
+}
+
+func loadBytecode(path string, data []byte) *compiler.Bytecode {
+	bytecode := &compiler.Bytecode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		fail(fmt.Errorf("%s: %w", path, err))
+	}
+	return bytecode
+}
+
+/* Whether path is a precompiled script, which always runs on the VM */
+func isBytecodeFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, len(compiler.Magic))
+	_, err = io.ReadFull(file, header)
+	return err == nil && compiler.IsBytecode(header)
+}
+
+func readFile(path string) []byte {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fail(err)
+	}
+	return src
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/* The test binary runs main instead of the tests when this is set */
+const runMainEnv = "MONKEY_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+/* Runs the command line with args, returns its stdout, stderr and exit code */
+func runMonkey(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("cannot run main: %s", err)
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+/* Precompiled scripts always run on the VM, so they can be traced with any -engine */
+func TestTraceBytecodeFile(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "prog.monkey")
+	if err := os.WriteFile(script, []byte("puts(1 + 2)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bytecode := filepath.Join(dir, "prog.mkc")
+	if _, stderr, code := runMonkey(t, "-o", bytecode, script); code != 0 {
+		t.Fatalf("compiling failed with %d: %s", code, stderr)
+	}
+
+	stdout, stderr, code := runMonkey(t, "-trace", bytecode)
+	if code != 0 {
+		t.Fatalf("tracing the bytecode file failed with %d: %s", code, stderr)
+	}
+	if stdout != "3\n" || !strings.Contains(stderr, "OpAdd") {
+		t.Errorf("wrong output [stdout=%q, stderr=%q]", stdout, stderr)
+	}
+
+	// a source file still needs the VM to be traced
+	_, stderr, code = runMonkey(t, "-trace", script)
+	if code != 2 || stderr != "-trace needs -engine=vm\n" {
+		t.Errorf("tracing a source file should fail [code=%d, stderr=%q]", code, stderr)
+	}
+}
@@ -0,0 +1,372 @@
+package monkey
+
+import (
+	"fmt"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+/*  ----------------------------------------------------------- */
+/*  --- Go to Monkey ------------------------------------------ */
+/*  ----------------------------------------------------------- */
+
+/*
+  Integers of any size become INTEGER and floats FLOAT, slices and arrays
+  become ARRAY and maps HASH, their keys sorted so the order is the same
+  on every run. Functions become builtins, nil and nil pointers null.
+  Values that already are objects are used as they are
+*/
+func toObject(value interface{}) (object.Object, error) {
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	return valueToObject(reflect.ValueOf(value))
+}
+
+func valueToObject(v reflect.Value) (object.Object, error) {
+	if v.Type().Implements(objectType) {
+		if isNil(v) {
+			return evaluator.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		return sliceToArray(v)
+	case reflect.Map:
+		return mapToHash(v)
+	case reflect.Func:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return newBuiltin("", v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return valueToObject(v.Elem())
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Monkey value", v.Type())
+}
+
+func sliceToArray(v reflect.Value) (object.Object, error) {
+	elements := make([]object.Object, v.Len())
+	for i := range elements {
+		element, err := valueToObject(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = element
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+func mapToHash(v reflect.Value) (object.Object, error) {
+	hash := object.NewHash()
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+	for _, key := range keys {
+		keyObj, err := valueToObject(key)
+		if err != nil {
+			return nil, err
+		}
+		hashKey, ok := keyObj.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", keyObj.Type())
+		}
+		value, err := valueToObject(v.MapIndex(key))
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(hashKey, value)
+	}
+	return hash, nil
+}
+
+/* Numbers in numeric order, anything else by how it prints */
+func lessKey(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+	switch {
+	case a.CanInt() && b.CanInt():
+		return a.Int() < b.Int()
+	case a.CanUint() && b.CanUint():
+		return a.Uint() < b.Uint()
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Monkey to Go ------------------------------------------ */
+/*  ----------------------------------------------------------- */
+
+/*
+  INTEGER becomes int64, FLOAT float64, ARRAY []interface{} and null nil.
+  A HASH becomes a map[string]interface{} when all of its keys are
+  strings, a map[interface{}]interface{} otherwise. Functions and the
+  other values with no Go counterpart are returned as the object itself,
+  so they can be passed back to Set or Call
+*/
+func toGo(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			elements[i] = toGo(element)
+		}
+		return elements
+	case *object.Hash:
+		return hashToMap(obj)
+	}
+	return obj
+}
+
+func hashToMap(hash *object.Hash) interface{} {
+	byName := map[string]interface{}{}
+	for _, pair := range hash.Pairs() {
+		key, ok := pair.Key.(*object.String)
+		if !ok {
+			break
+		}
+		byName[key.Value] = toGo(pair.Value)
+	}
+	if len(byName) == hash.Len() {
+		return byName
+	}
+
+	values := map[interface{}]interface{}{}
+	for _, pair := range hash.Pairs() {
+		values[toGo(pair.Key)] = toGo(pair.Value)
+	}
+	return values
+}
+
+/*
+  Converts obj to the Go type t, eg. for the parameters of a builtin.
+  Integers convert to any integer type they fit in and to floats, null to
+  the zero value of pointers, slices, maps and interfaces
+*/
+func toValue(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface {
+		if t.NumMethod() == 0 {
+			return goValue(toGo(obj), t), nil
+		}
+		if reflect.TypeOf(obj).Implements(t) {
+			return reflect.ValueOf(obj).Convert(t), nil
+		}
+		return reflect.Value{}, cannotUse(obj, t)
+	}
+	if obj == evaluator.NULL && isNil(reflect.Zero(t)) {
+		return reflect.Zero(t), nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		if t.Kind() == reflect.Bool {
+			v.SetBool(obj.Value)
+			return v, nil
+		}
+	case *object.String:
+		if t.Kind() == reflect.String {
+			v.SetString(obj.Value)
+			return v, nil
+		}
+	case *object.Integer:
+		switch {
+		case v.CanInt() && !v.OverflowInt(obj.Value):
+			v.SetInt(obj.Value)
+			return v, nil
+		case v.CanUint() && obj.Value >= 0 && !v.OverflowUint(uint64(obj.Value)):
+			v.SetUint(uint64(obj.Value))
+			return v, nil
+		case v.CanFloat():
+			v.SetFloat(float64(obj.Value))
+			return v, nil
+		}
+	case *object.Float:
+		if v.CanFloat() {
+			v.SetFloat(obj.Value)
+			return v, nil
+		}
+	case *object.Array:
+		if t.Kind() == reflect.Slice {
+			return arrayToSlice(obj, t)
+		}
+	case *object.Hash:
+		if t.Kind() == reflect.Map {
+			return hashToTypedMap(obj, t)
+		}
+	}
+	return reflect.Value{}, cannotUse(obj, t)
+}
+
+func arrayToSlice(array *object.Array, t reflect.Type) (reflect.Value, error) {
+	slice := reflect.MakeSlice(t, len(array.Elements), len(array.Elements))
+	for i, element := range array.Elements {
+		value, err := toValue(element, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		slice.Index(i).Set(value)
+	}
+	return slice, nil
+}
+
+func hashToTypedMap(hash *object.Hash, t reflect.Type) (reflect.Value, error) {
+	m := reflect.MakeMapWithSize(t, hash.Len())
+	for _, pair := range hash.Pairs() {
+		key, err := toValue(pair.Key, t.Key())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value, err := toValue(pair.Value, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		m.SetMapIndex(key, value)
+	}
+	return m, nil
+}
+
+/* A nil interface{} has no value, reflect needs the zero value of t */
+func goValue(value interface{}, t reflect.Type) reflect.Value {
+	if value == nil {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(value)
+}
+
+func cannotUse(obj object.Object, t reflect.Type) error {
+	return fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Builtins ---------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  Wraps a Go function so Monkey code can call it. The arguments are
+  converted to the parameter types, variadic functions take any number of
+  trailing arguments. The function may return nothing, a value, an error
+  or a value and an error; a non-nil error becomes a Monkey runtime error
+*/
+func newBuiltin(name string, fn reflect.Value) (object.Object, error) {
+	t := fn.Type()
+	if t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return nil, fmt.Errorf("%s must return at most a value and an error", t)
+	}
+
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		in, err := builtinArguments(name, t, args)
+		if err != nil {
+			return err
+		}
+		return builtinResult(name, fn.Call(in))
+	}}, nil
+}
+
+func builtinArguments(name string, t reflect.Type, args []object.Object) ([]reflect.Value, *object.Error) {
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, newError("wrong number of arguments: expected at least %d, got %d", fixed, len(args))
+		}
+	} else if len(args) != fixed {
+		return nil, newError("wrong number of arguments: expected %d, got %d", fixed, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if i < fixed {
+			paramType = t.In(i)
+		} else {
+			paramType = t.In(fixed).Elem()
+		}
+		value, err := toValue(arg, paramType)
+		if err != nil {
+			return nil, newError("argument %d to %s: %s", i+1, describe(name), err)
+		}
+		in[i] = value
+	}
+	return in, nil
+}
+
+func builtinResult(name string, out []reflect.Value) object.Object {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err := out[len(out)-1]; !err.IsNil() {
+			return newError("%s", err.Interface().(error))
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil
+	}
+
+	result, err := valueToObject(out[0])
+	if err != nil {
+		return newError("result of %s: %s", describe(name), err)
+	}
+	return result
+}
+
+/* `name` or "function" for functions converted without a name */
+func describe(name string) string {
+	if name == "" {
+		return "function"
+	}
+	return "`" + name + "`"
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
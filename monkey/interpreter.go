@@ -0,0 +1,161 @@
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"reflect"
+)
+
+/*
+  Globals set from Go, registered functions and the bindings made by top
+  level let statements all live in one scope, which is kept from one Eval
+  to the next, just like in the REPL. The same goes for macros. An
+  Interpreter must not be used from several goroutines at once
+*/
+type Interpreter struct {
+	env      *object.Environment
+	macroEnv *object.Environment
+	importer *evaluator.Importer
+}
+
+/* Runtime errors of the Monkey code, eg. a type mismatch or an unknown name */
+type RuntimeError struct {
+	Message string
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+
+/* Imports are resolved from the current directory, then from MONKEYPATH */
+func New() *Interpreter {
+	importer := evaluator.NewImporter(evaluator.SearchPath())
+	env := object.NewEnvironment()
+	env.SetLoader(importer)
+	return &Interpreter{env: env, macroEnv: object.NewEnvironment(), importer: importer}
+}
+
+/*
+  Runs src and returns the value of its last statement, converted like Get
+  does. Parse errors are returned as a parser.ErrorList and failures of the
+  code as a *RuntimeError. When ctx is done the code stops at the next loop
+  iteration or function call and ctx.Err() is returned
+*/
+func (in *Interpreter) Eval(ctx context.Context, src string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(src))
+	code := p.ParseCode()
+	if err := p.Errors().Err(); err != nil {
+		return nil, err
+	}
+	evaluator.DefineMacros(code, in.macroEnv)
+	expanded, errObj := evaluator.ExpandMacros(code, in.macroEnv)
+	if errObj != nil {
+		return nil, &RuntimeError{Message: errObj.Message}
+	}
+
+	in.env.SetContext(ctx)
+	in.importer.SetContext(ctx)
+	defer in.env.SetContext(nil)
+	defer in.importer.SetContext(nil)
+	result := evaluator.Eval(expanded, in.env)
+	if errObj, ok := result.(*object.Error); ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, &RuntimeError{Message: errObj.Message}
+	}
+	return toGo(result), nil
+}
+
+/*
+  Binds name to value as if a top level let statement did. Integers of
+  any size become INTEGER, floats FLOAT, slices ARRAY and maps HASH, with
+  their elements converted the same way. Functions are registered like
+  Register does and object.Object values are used as they are
+*/
+func (in *Interpreter) Set(name string, value interface{}) error {
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.Func {
+		return in.Register(name, value)
+	}
+	obj, err := toObject(value)
+	if err != nil {
+		return fmt.Errorf("cannot set %s: %w", name, err)
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+/*
+  Returns the value bound to name and whether there is one. INTEGER
+  becomes int64, FLOAT float64, ARRAY []interface{} and null nil. A HASH
+  becomes a map[string]interface{} when all of its keys are strings and a
+  map[interface{}]interface{} otherwise. Functions and the other values
+  with no Go counterpart are returned as their object.Object
+*/
+func (in *Interpreter) Get(name string) (interface{}, bool) {
+	obj, ok := in.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return toGo(obj), true
+}
+
+/*
+  Calls the Monkey function bound to name, or a builtin, with args
+  converted like Set does. The result is converted like Get does
+*/
+func (in *Interpreter) Call(fnName string, args ...interface{}) (interface{}, error) {
+	fn, ok := in.env.Get(fnName)
+	if !ok {
+		if builtin := object.GetBuiltinByName(fnName); builtin != nil {
+			fn = builtin
+		} else {
+			return nil, &RuntimeError{Message: "identifier not found: " + fnName}
+		}
+	}
+
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := toObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to %s: %w", i+1, fnName, err)
+		}
+		objs[i] = obj
+	}
+
+	result := evaluator.Apply(fn, objs)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Message: errObj.Message}
+	}
+	return toGo(result), nil
+}
+
+/*
+  Makes the Go function fn callable from Monkey code as name. The
+  arguments are converted to the parameter types: int64 and the other
+  integer types, float64, bool, string, slices, maps, interface{} (which
+  gets the value as Get returns it) and object.Object. Variadic functions
+  take any number of trailing arguments. fn may return nothing, a value,
+  an error or a value and an error; a non-nil error becomes a runtime
+  error of the Monkey code. Like any global, name can be rebound by a let
+*/
+func (in *Interpreter) Register(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fmt.Errorf("cannot register %s: %T is not a function", name, fn)
+	}
+	if v.IsNil() {
+		return fmt.Errorf("cannot register %s: the function is nil", name)
+	}
+	builtin, err := newBuiltin(name, v)
+	if err != nil {
+		return fmt.Errorf("cannot register %s: %w", name, err)
+	}
+	in.env.Set(name, builtin)
+	return nil
+}
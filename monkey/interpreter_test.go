@@ -0,0 +1,371 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"let x = 1;", nil},
+		{"[1, true, [2]]", []interface{}{int64(1), true, []interface{}{int64(2)}}},
+		{`{"a": 1, "b": [2]}`, map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2)}}},
+		{`{1: "one", "two": 2}`, map[interface{}]interface{}{int64(1): "one", "two": int64(2)}},
+	}
+	for _, tt := range tests {
+		result, err := New().Eval(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("%s failed: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("wrong result for %s. expected=%#v [actual=%#v]", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestEvalKeepsState(t *testing.T) {
+	in := New()
+	lines := []string{
+		"let x = 5;",
+		"let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };",
+		"let double = fn(n) { n * 2 };",
+		"unless(x > 10, double(x), 0)",
+	}
+	var result interface{}
+	for _, line := range lines {
+		var err error
+		if result, err = in.Eval(context.Background(), line); err != nil {
+			t.Fatalf("%s failed: %s", line, err)
+		}
+	}
+	if result != int64(10) {
+		t.Errorf("wrong result. expected=%#v [actual=%#v]", int64(10), result)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	in := New()
+
+	_, err := in.Eval(context.Background(), "let x = ;")
+	var parseErrors parser.ErrorList
+	if !errors.As(err, &parseErrors) {
+		t.Errorf("expected parser errors [actual=%#v]", err)
+	}
+
+	_, err = in.Eval(context.Background(), "1 + true")
+	var runtimeError *RuntimeError
+	if !errors.As(err, &runtimeError) {
+		t.Fatalf("expected a runtime error [actual=%#v]", err)
+	}
+	if runtimeError.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. expected=%q [actual=%q]",
+			"type mismatch: INTEGER + BOOLEAN", runtimeError.Message)
+	}
+}
+
+func TestEvalCancellation(t *testing.T) {
+	inputs := []string{
+		"while (true) { }",
+		"let f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(100)",
+		"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; while (true) { f(10) }",
+	}
+	// the code of modules stops too, when they are loaded and when their
+	// functions are called
+	dir := t.TempDir()
+	files := map[string]string{
+		"spin.monkey": "export let spin = fn() { while (true) { } };",
+		"loop.monkey": "while (true) { }",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, fmt.Sprintf("import %q as m; m.spin()", path))
+	}
+	in := New()
+	for _, input := range inputs {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := in.Eval(ctx, input)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s was not stopped. expected=%q [actual=%v]", input, context.DeadlineExceeded, err)
+		}
+	}
+
+	// the interpreter is still usable afterwards
+	result, err := in.Eval(context.Background(), "let i = 0; while (i < 3) { i += 1; }; i")
+	if err != nil || result != int64(3) {
+		t.Errorf("interpreter unusable after cancellation. expected=3 [actual=%v, %v]", result, err)
+	}
+}
+
+/* Runaway recursion is an error of the code, it doesn't abort the host */
+func TestEvalStackOverflow(t *testing.T) {
+	_, err := New().Eval(context.Background(), "let f = fn(n) { f(n + 1) }; f(0)")
+	var runtimeError *RuntimeError
+	if !errors.As(err, &runtimeError) || runtimeError.Message != "stack overflow" {
+		t.Errorf("wrong error. expected=%q [actual=%v]", "stack overflow", err)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		inspect  string
+		expected interface{}
+	}{
+		{42, "42", int64(42)},
+		{uint8(7), "7", int64(7)},
+		{float32(0.5), "0.5", 0.5},
+		{true, "true", true},
+		{"hi", "hi", "hi"},
+		{nil, "null", nil},
+		{[]string{"a", "b"}, "[a, b]", []interface{}{"a", "b"}},
+		{[2]int{1, 2}, "[1, 2]", []interface{}{int64(1), int64(2)}},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}", map[string]interface{}{"a": int64(1), "b": int64(2)}},
+		{map[int]bool{10: true, 9: false}, "{9: false, 10: true}", map[interface{}]interface{}{int64(9): false, int64(10): true}},
+		{map[string][]interface{}{"x": {1, "y", nil}}, "{x: [1, y, null]}",
+			map[string]interface{}{"x": []interface{}{int64(1), "y", nil}}},
+		{&object.Integer{Value: 3}, "3", int64(3)},
+	}
+	for _, tt := range tests {
+		in := New()
+		if err := in.Set("v", tt.value); err != nil {
+			t.Errorf("cannot set %#v: %s", tt.value, err)
+			continue
+		}
+		inspect, err := in.Eval(context.Background(), "v")
+		if err != nil {
+			t.Errorf("cannot read %#v back: %s", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(inspect, tt.expected) {
+			t.Errorf("wrong value for %#v. expected=%#v [actual=%#v]", tt.value, tt.expected, inspect)
+		}
+
+		obj, _ := in.env.Get("v")
+		if obj.Inspect() != tt.inspect {
+			t.Errorf("wrong object for %#v. expected=%q [actual=%q]", tt.value, tt.inspect, obj.Inspect())
+		}
+		got, ok := in.Get("v")
+		if !ok || !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong Get for %#v. expected=%#v [actual=%#v]", tt.value, tt.expected, got)
+		}
+	}
+
+	in := New()
+	if _, ok := in.Get("missing"); ok {
+		t.Errorf("Get found a name that was never set")
+	}
+	errorTests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{struct{}{}, "cannot set v: cannot convert struct {} to a Monkey value"},
+		{uint64(1 << 63), "cannot set v: 9223372036854775808 overflows INTEGER"},
+		{map[float64]int{1.5: 1}, "cannot set v: unusable as hash key: FLOAT"},
+		{[]chan int{nil}, "cannot set v: cannot convert chan int to a Monkey value"},
+	}
+	for _, tt := range errorTests {
+		err := in.Set("v", tt.value)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %#v. expected=%q [actual=%v]", tt.value, tt.expected, err)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	in := New()
+	_, err := in.Eval(context.Background(), `
+		let add = fn(a, b) { a + b };
+		let names = fn(h) { keys(h) };
+		let fail = fn() { 1 / 0 };
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fn       string
+		args     []interface{}
+		expected interface{}
+	}{
+		{"add", []interface{}{1, 2}, int64(3)},
+		{"add", []interface{}{"a", "b"}, "ab"},
+		{"names", []interface{}{map[string]int{"y": 1, "x": 2}}, []interface{}{"x", "y"}},
+		{"len", []interface{}{[]int{1, 2, 3}}, int64(3)},
+	}
+	for _, tt := range tests {
+		result, err := in.Call(tt.fn, tt.args...)
+		if err != nil {
+			t.Errorf("%s%v failed: %s", tt.fn, tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("wrong result for %s%v. expected=%#v [actual=%#v]", tt.fn, tt.args, tt.expected, result)
+		}
+	}
+
+	errorTests := []struct {
+		fn       string
+		args     []interface{}
+		expected string
+	}{
+		{"fail", nil, "division by zero: 1 / 0"},
+		{"add", []interface{}{1}, "wrong number of arguments: expected 2, got 1"},
+		{"missing", nil, "identifier not found: missing"},
+		{"add", []interface{}{1, struct{}{}}, "argument 2 to add: cannot convert struct {} to a Monkey value"},
+	}
+	for _, tt := range errorTests {
+		_, err := in.Call(tt.fn, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %s%v. expected=%q [actual=%v]", tt.fn, tt.args, tt.expected, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	in := New()
+	functions := map[string]interface{}{
+		"add":    func(a, b int64) int64 { return a + b },
+		"small":  func(n int8) int8 { return n },
+		"half":   func(x float64) float64 { return x / 2 },
+		"upper":  strings.ToUpper,
+		"not":    func(b bool) bool { return !b },
+		"sum":    func(prefix string, ns ...int) string { return fmt.Sprint(prefix, len(ns)) },
+		"join":   func(parts []string) string { return strings.Join(parts, "-") },
+		"count":  func(m map[string][]int) map[string]int { return countValues(m) },
+		"kind":   func(v interface{}) string { return fmt.Sprintf("%T", v) },
+		"type":   func(obj object.Object) string { return string(obj.Type()) },
+		"noop":   func() {},
+		"check":  func(n int) error { return checkPositive(n) },
+		"sqrt":   func(n int) (int, error) { return n / 2, checkPositive(n) },
+		"nested": func() []interface{} { return []interface{}{func(n int) int { return n + 1 }} },
+	}
+	in.Set("none", nil)
+	for name, fn := range functions {
+		if err := in.Register(name, fn); err != nil {
+			t.Fatalf("cannot register %s: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"add(1, 2)", int64(3)},
+		{"small(-128)", int64(-128)},
+		{"half(3)", 1.5},
+		{"half(3.0)", 1.5},
+		{`upper("monkey")`, "MONKEY"},
+		{"not(false)", true},
+		{`sum("n")`, "n0"},
+		{`sum("n", 1, 2, 3)`, "n3"},
+		{`join(["a", "b", "c"])`, "a-b-c"},
+		{`join(none)`, ""},
+		{`count({"a": [1, 2], "b": []})`, map[string]interface{}{"a": int64(2), "b": int64(0)}},
+		{`kind(1)`, "int64"},
+		{`kind([1])`, "[]interface {}"},
+		{`kind(none)`, "<nil>"},
+		{`type(fn() {})`, "FUNCTION"},
+		{"noop()", nil},
+		{"check(1)", nil},
+		{"sqrt(8)", int64(4)},
+		{"nested()[0](1)", int64(2)},
+		{"let add = fn(a, b) { a - b }; add(1, 2)", int64(-1)},
+	}
+	for _, tt := range tests {
+		result, err := in.Eval(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("%s failed: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("wrong result for %s. expected=%#v [actual=%#v]", tt.input, tt.expected, result)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"half()", "wrong number of arguments: expected 1, got 0"},
+		{"sum()", "wrong number of arguments: expected at least 1, got 0"},
+		{`not(1)`, "argument 1 to `not`: cannot use INTEGER as bool"},
+		{`small(128)`, "argument 1 to `small`: cannot use INTEGER as int8"},
+		{`sum("n", 1, "2")`, "argument 3 to `sum`: cannot use STRING as int"},
+		{`join([1])`, "argument 1 to `join`: cannot use INTEGER as string"},
+		{`count({"a": 1})`, "argument 1 to `count`: cannot use INTEGER as []int"},
+		{`half(none)`, "argument 1 to `half`: cannot use NULL as float64"},
+		{"check(-1)", "-1 is negative"},
+		{"sqrt(-8)", "-8 is negative"},
+		{"nested()[0](true)", "argument 1 to function: cannot use BOOLEAN as int"},
+	}
+	for _, tt := range errorTests {
+		_, err := in.Eval(context.Background(), tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. expected=%q [actual=%v]", tt.input, tt.expected, err)
+		}
+	}
+
+	registerErrors := []struct {
+		fn       interface{}
+		expected string
+	}{
+		{42, "cannot register f: int is not a function"},
+		{(func())(nil), "cannot register f: the function is nil"},
+		{func() (int, int) { return 0, 0 }, "cannot register f: func() (int, int) must return at most a value and an error"},
+	}
+	for _, tt := range registerErrors {
+		err := in.Register("f", tt.fn)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %T. expected=%q [actual=%v]", tt.fn, tt.expected, err)
+		}
+	}
+}
+
+/* Set takes functions too and registers them */
+func TestSetFunction(t *testing.T) {
+	in := New()
+	if err := in.Set("greet", func(name string) string { return "hello " + name }); err != nil {
+		t.Fatal(err)
+	}
+	result, err := in.Call("greet", "monkey")
+	if err != nil || result != "hello monkey" {
+		t.Errorf("wrong result. expected=%q [actual=%v, %v]", "hello monkey", result, err)
+	}
+}
+
+func countValues(m map[string][]int) map[string]int {
+	counts := map[string]int{}
+	for k, v := range m {
+		counts[k] = len(v)
+	}
+	return counts
+}
+
+func checkPositive(n int) error {
+	if n < 0 {
+		return fmt.Errorf("%d is negative", n)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+/*
+  Functions available everywhere without being bound by a 'let'.
+  The order matters to anything that refers to builtins by index
+*/
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{"len", &Builtin{Fn: builtinLen}},
+	{"puts", &Builtin{Fn: builtinPuts}},
+	{"first", &Builtin{Fn: builtinFirst}},
+	{"last", &Builtin{Fn: builtinLast}},
+	{"rest", &Builtin{Fn: builtinRest}},
+	{"push", &Builtin{Fn: builtinPush}},
+	{"keys", &Builtin{Fn: builtinKeys}},
+	{"values", &Builtin{Fn: builtinValues}},
+	{"put", &Builtin{Fn: builtinPut}},
+	{"delete", &Builtin{Fn: builtinDelete}},
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+/* Strings are measured in characters, not bytes */
+func builtinLen(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments: expected 1, got %d", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *String:
+		return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+	case *Hash:
+		return &Integer{Value: int64(arg.Len())}
+	default:
+		return newError("argument to `len` not supported, got %s", args[0].Type())
+	}
+}
+
+func builtinPuts(args ...Object) Object {
+	for _, arg := range args {
+		fmt.Println(arg.Inspect())
+	}
+	return nil
+}
+
+func builtinFirst(args ...Object) Object {
+	arr, err := arrayArgument("first", args)
+	if err != nil {
+		return err
+	}
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+	return nil
+}
+
+func builtinLast(args ...Object) Object {
+	arr, err := arrayArgument("last", args)
+	if err != nil {
+		return err
+	}
+	length := len(arr.Elements)
+	if length > 0 {
+		return arr.Elements[length-1]
+	}
+	return nil
+}
+
+/* Everything but the first element, as a new array */
+func builtinRest(args ...Object) Object {
+	arr, err := arrayArgument("rest", args)
+	if err != nil {
+		return err
+	}
+	length := len(arr.Elements)
+	if length > 0 {
+		newElements := make([]Object, length-1)
+		copy(newElements, arr.Elements[1:length])
+		return &Array{Elements: newElements}
+	}
+	return nil
+}
+
+/* Returns a new array, the one passed in is left untouched */
+func builtinPush(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments: expected 2, got %d", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+	}
+	length := len(arr.Elements)
+	newElements := make([]Object, length+1)
+	copy(newElements, arr.Elements)
+	newElements[length] = args[1]
+	return &Array{Elements: newElements}
+}
+
+/* The keys of a hash, in insertion order */
+func builtinKeys(args ...Object) Object {
+	hash, err := hashArgument("keys", args, 1)
+	if err != nil {
+		return err
+	}
+	keys := []Object{}
+	for _, pair := range hash.Pairs() {
+		keys = append(keys, pair.Key)
+	}
+	return &Array{Elements: keys}
+}
+
+func builtinValues(args ...Object) Object {
+	hash, err := hashArgument("values", args, 1)
+	if err != nil {
+		return err
+	}
+	values := []Object{}
+	for _, pair := range hash.Pairs() {
+		values = append(values, pair.Value)
+	}
+	return &Array{Elements: values}
+}
+
+/* put(hash, key, value), returns a new hash with the pair added or replaced */
+func builtinPut(args ...Object) Object {
+	hash, err := hashArgument("put", args, 3)
+	if err != nil {
+		return err
+	}
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+	newHash := hash.Copy()
+	newHash.Set(key, args[2])
+	return newHash
+}
+
+/* delete(hash, key), returns a new hash without the key */
+func builtinDelete(args ...Object) Object {
+	hash, err := hashArgument("delete", args, 2)
+	if err != nil {
+		return err
+	}
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+	newHash := hash.Copy()
+	newHash.Delete(key)
+	return newHash
+}
+
+func hashArgument(name string, args []Object, want int) (*Hash, *Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments: expected %d, got %d", want, len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	return hash, nil
+}
+
+func arrayArgument(name string, args []Object) (*Array, *Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments: expected 1, got %d", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	return arr, nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
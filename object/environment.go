@@ -0,0 +1,118 @@
+package object
+
+import "context"
+
+/*
+  Bindings created by 'let' statements and function parameters.
+  Lookups that miss fall back to the outer (enclosing) scope
+*/
+type Environment struct {
+	store  map[string]Object
+	outer  *Environment
+	loader ModuleLoader
+	ctx    context.Context
+	depth  int // how many function calls deep the scope is
+}
+
+/*
+  Resolves, evaluates and caches the modules named by import statements.
+  It's set on the outermost scope and shared by everything evaluated in it
+*/
+type ModuleLoader interface {
+	// Returns the *Module for path or an *Error
+	Import(path string) Object
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+/*
+  Scope for a function call, extends the scope the function was defined
+  in. It starts at the depth of outer, a call sets its own with SetDepth
+*/
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	env.depth = outer.depth
+	return env
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+/*
+  Rebinds an existing name in the nearest scope that has it. Returns false
+  when no scope does, assignment never creates a binding
+*/
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+/* The module loader of the outermost scope, nil when there is none */
+func (e *Environment) Loader() ModuleLoader {
+	for env := e; env != nil; env = env.outer {
+		if env.loader != nil {
+			return env.loader
+		}
+	}
+	return nil
+}
+
+func (e *Environment) SetLoader(loader ModuleLoader) {
+	e.loader = loader
+}
+
+/*
+  A module loader that knows the context of the code importing through
+  it, the scopes of the modules it runs get it from there
+*/
+type ContextLoader interface {
+	ModuleLoader
+	Context() context.Context
+}
+
+/*
+  The context of the outermost scope, or else of its module loader. nil
+  when there is none. Evaluation stops with an error once it is done
+*/
+func (e *Environment) Context() context.Context {
+	for env := e; env != nil; env = env.outer {
+		if env.ctx != nil {
+			return env.ctx
+		}
+	}
+	if loader, ok := e.Loader().(ContextLoader); ok {
+		return loader.Context()
+	}
+	return nil
+}
+
+func (e *Environment) SetContext(ctx context.Context) {
+	e.ctx = ctx
+}
+
+/* The number of function calls the code of this scope runs in */
+func (e *Environment) Depth() int {
+	return e.depth
+}
+
+func (e *Environment) SetDepth(depth int) {
+	e.depth = depth
+}
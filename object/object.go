@@ -0,0 +1,405 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/code"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	STRING_OBJ       = "STRING"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+	MODULE_OBJ       = "MODULE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+)
+
+/*  ----------------------------------------------------------- */
+/*  --- Interfaces -------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* Every value produced while evaluating Monkey code is an Object */
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+/*
+  Objects that can be used as hash keys. Equal values must return equal
+  keys, and keys are stable across runs so they never depend on pointers
+*/
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Values ------------------------------------------------ */
+/*  ----------------------------------------------------------- */
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+/* Floats are not Hashable, 0.1 + 0.2 would not find the key 0.3 */
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+/* Always reads back as a float, 2.0 and not 2 */
+func (f *Float) Inspect() string {
+	out := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(out, ".eIN") {
+		out += ".0"
+	}
+	return out
+}
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+/* Absence of a value, eg. the result of an if without an else branch */
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+/*
+  Wraps the value of a 'return' statement so the evaluator can unwind
+  nested blocks until it reaches the enclosing function or the top level
+*/
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+/*
+  Signals for break and continue. Like a return value they make the
+  enclosing blocks stop, the innermost loop consumes them
+*/
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+/* Runtime errors, they stop evaluation just like a return value does */
+type Error struct {
+	Message string
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+/*
+  Functions are first class values. Env is the scope the function literal
+  was evaluated in, which is what makes closures work
+*/
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+	return out.String()
+}
+
+/*
+  Functions implemented in Go. Returning nil means the call produced no
+  value, the evaluator turns that into null
+*/
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+type Array struct {
+	Elements []Object
+}
+
+func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
+func (ao *Array) Inspect() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, e := range ao.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+type HashPair struct {
+	Key   Hashable
+	Value Object
+}
+
+/*
+  Hash maps. Pairs remember the order they were first inserted in, so
+  printing and iterating over a hash always gives the same result
+*/
+type Hash struct {
+	pairs map[HashKey]HashPair
+	order []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, pair := range h.Pairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+/* Updating an existing key keeps its original position */
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.pairs[hashKey]; !ok {
+		h.order = append(h.order, hashKey)
+	}
+	h.pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+func (h *Hash) Delete(key Hashable) {
+	hashKey := key.HashKey()
+	if _, ok := h.pairs[hashKey]; !ok {
+		return
+	}
+	delete(h.pairs, hashKey)
+	for i, k := range h.order {
+		if k == hashKey {
+			h.order = append(h.order[:i:i], h.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (h *Hash) Len() int { return len(h.order) }
+
+/* All the pairs in insertion order */
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.order))
+	for _, k := range h.order {
+		pairs = append(pairs, h.pairs[k])
+	}
+	return pairs
+}
+
+/* Shallow copy, used by builtins that return a modified hash */
+func (h *Hash) Copy() *Hash {
+	c := NewHash()
+	for _, pair := range h.Pairs() {
+		c.Set(pair.Key, pair.Value)
+	}
+	return c
+}
+
+/* An unevaluated piece of code, the result of quote(...) */
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+/*
+  Macros only exist during macro expansion, Env is the scope holding the
+  macro definitions
+*/
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+	return out.String()
+}
+
+/*
+  An imported file. Only the bindings the file exported are reachable,
+  the rest of its scope stays private to the file's own functions
+*/
+type Module struct {
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + m.Path + ">" }
+
+/*  ----------------------------------------------------------- */
+/*  --- Bytecode ---------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  A function literal compiled to bytecode, it lives in the constant pool.
+  Locals holds the names of the local slots, parameters first, so the VM
+  can report the name of a variable that is used before it is bound.
+  Body is the source of the body, functions print like the evaluator's.
+  Lines maps the instructions to source lines
+*/
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Locals        []string
+	Captures      []Capture
+	Fallbacks     []Fallback
+	Body          string
+	Lines         code.LineTable
+}
+
+/*
+  Where a closure finds one of its free variables when it is created:
+  a local slot of the enclosing function or one of the enclosing
+  closure's own free variables
+*/
+type Capture struct {
+	Local bool
+	Index int
+	Name  string
+}
+
+/*
+  The variable a local slot stands for until its let has run, like the
+  outer x in 'let x = x + 1'. Scope is "GLOBAL", "LOCAL" (another slot of
+  the same frame) or "FREE" (a free variable of the closure)
+*/
+type Fallback struct {
+	Local int
+	Scope string
+	Index int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return "fn(" + strings.Join(cf.Locals[:cf.NumParameters], ", ") + ") {\n" + cf.Body + "\n}"
+}
+
+/*
+  The values a compiled program refers to by index. Closures keep the
+  program they were created in, so a function exported by a module still
+  sees the module's own constants and globals when it is called elsewhere
+*/
+type Program struct {
+	Constants   []Object
+	Globals     []Object
+	GlobalNames []string
+}
+
+/*
+  A function value of the VM, Free holds the captured variables. It has
+  the type of the evaluator's functions so error messages are the same
+*/
+type Closure struct {
+	Fn      *CompiledFunction
+	Free    []Object
+	Program *Program
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string  { return c.Fn.Inspect() }
@@ -0,0 +1,52 @@
+package object
+
+import "testing"
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeysDependOnType(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("1 and true have the same hash key")
+	}
+	if one.HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("integers with same value have different hash keys")
+	}
+}
+
+func TestHashKeepsInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 2}, &Integer{Value: 2})
+	hash.Set(&Boolean{Value: true}, &Integer{Value: 3})
+	hash.Set(&String{Value: "b"}, &Integer{Value: 4})
+
+	if hash.Inspect() != "{b: 4, 2: 2, true: 3}" {
+		t.Errorf("hash.Inspect() wrong [actual=%q]", hash.Inspect())
+	}
+
+	hash.Delete(&Integer{Value: 2})
+	hash.Set(&Integer{Value: 2}, &Integer{Value: 5})
+	if hash.Inspect() != "{b: 4, true: 3, 2: 5}" {
+		t.Errorf("hash.Inspect() wrong after delete [actual=%q]", hash.Inspect())
+	}
+	if hash.Len() != 3 {
+		t.Errorf("hash.Len() wrong [actual=%d]", hash.Len())
+	}
+}
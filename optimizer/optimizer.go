@@ -0,0 +1,294 @@
+package optimizer
+
+import (
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"gomonkey/token"
+	"strconv"
+)
+
+/* The passes to run, they combine with | */
+type Pass uint
+
+const (
+	FoldConstants   Pass = 1 << iota // (5 * 10) -> 50, (-(-3)) -> 3
+	FoldBranches                     // if (true) { a } else { b } -> a
+	DropUnreachable                  // statements after a return in a block
+
+	All = FoldConstants | FoldBranches | DropUnreachable
+)
+
+var passes = []struct {
+	pass     Pass
+	modifier ast.ModifierFunc
+}{
+	{FoldConstants, foldConstants},
+	{FoldBranches, foldBranches},
+	{DropUnreachable, dropUnreachable},
+}
+
+/*
+  Returns an optimized copy of code, which must have gone through macro
+  expansion already. The result evaluates exactly like the original,
+  errors included: an operation that fails is left for the program to
+  fail on. The arguments of quote(...) are data and stay as they are, but
+  function bodies print in their optimized form
+*/
+func Optimize(code *ast.Code, enabled Pass) *ast.Code {
+	for _, p := range passes {
+		if enabled&p.pass != 0 {
+			code = ast.Modify(code, keepQuotes(quotedArguments(code), p.modifier)).(*ast.Code)
+		}
+	}
+	return code
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Quotes ------------------------------------------------ */
+/*  ----------------------------------------------------------- */
+
+/*
+  ast.Modify rewrites the arguments of a quote call before the call
+  itself, so they are put back from the original tree. These are the
+  arguments of every quote call in code, in the order ast.Modify reaches
+  the calls: after their children. Positions can't tell the calls apart,
+  a macro emits a quote call at the same position each time it expands
+*/
+func quotedArguments(code *ast.Code) [][]ast.Expression {
+	quoted := [][]ast.Expression{}
+	walking := []ast.Node{}
+	ast.Inspect(code, func(node ast.Node) bool {
+		if node != nil {
+			walking = append(walking, node)
+			return true
+		}
+		node = walking[len(walking)-1]
+		walking = walking[:len(walking)-1]
+		if call, ok := node.(*ast.CallExpression); ok && isQuote(call) {
+			quoted = append(quoted, call.Arguments)
+		}
+		return true
+	})
+	return quoted
+}
+
+func keepQuotes(quoted [][]ast.Expression, modifier ast.ModifierFunc) ast.ModifierFunc {
+	next := 0
+	return func(node ast.Node) ast.Node {
+		if call, ok := node.(*ast.CallExpression); ok && isQuote(call) {
+			call.Arguments = quoted[next]
+			next++
+			return call
+		}
+		return modifier(node)
+	}
+}
+
+func isQuote(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "quote"
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Constant folding -------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* Operators on literals are computed with the evaluator's own operators */
+func foldConstants(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return foldLogical(node)
+		}
+		left, ok := literalValue(node.Left)
+		if !ok {
+			return node
+		}
+		right, ok := literalValue(node.Right)
+		if !ok {
+			return node
+		}
+		return foldedOr(node, evaluator.Infix(node.Operator, left, right))
+
+	case *ast.PrefixExpression:
+		right, ok := literalValue(node.Right)
+		if !ok {
+			return node
+		}
+		return foldedOr(node, evaluator.Prefix(node.Operator, right))
+	}
+	return node
+}
+
+/*
+  The right side of && and || only runs when the left one doesn't decide,
+  so a literal on the left is enough to fold 'false && f()'
+*/
+func foldLogical(node *ast.InfixExpression) ast.Node {
+	left, ok := literalValue(node.Left)
+	if !ok {
+		return node
+	}
+	truthy := evaluator.IsTruthy(left)
+	if node.Operator == "&&" && !truthy || node.Operator == "||" && truthy {
+		return literalNode(truthy, node.Token.Pos)
+	}
+
+	right, ok := literalValue(node.Right)
+	if !ok {
+		return node
+	}
+	return literalNode(evaluator.IsTruthy(right), node.Token.Pos)
+}
+
+/* The literal for result, or node itself when the operation failed */
+func foldedOr(node ast.Expression, result object.Object) ast.Node {
+	pos := ast.Pos(node)
+	switch result := result.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(result.Value, 10), Pos: pos},
+			Value: result.Value,
+		}
+	case *object.Float:
+		return &ast.FloatLiteral{
+			Token: token.Token{Type: token.FLOAT, Literal: result.Inspect(), Pos: pos},
+			Value: result.Value,
+		}
+	case *object.String:
+		return &ast.StringLiteral{
+			Token: token.Token{Type: token.STRING, Literal: result.Value, Pos: pos},
+			Value: result.Value,
+		}
+	case *object.Boolean:
+		return literalNode(result.Value, pos)
+	}
+	return node
+}
+
+func literalNode(value bool, pos token.Position) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos}, Value: true}
+	}
+	return &ast.Boolean{Token: token.Token{Type: token.FALS, Literal: "false", Pos: pos}, Value: false}
+}
+
+/* The value of a literal, as the evaluator would compute it */
+func literalValue(exp ast.Expression) (object.Object, bool) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: exp.Value}, true
+	case *ast.FloatLiteral:
+		return &object.Float{Value: exp.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: exp.Value}, true
+	case *ast.Boolean:
+		if exp.Value {
+			return evaluator.TRUE, true
+		}
+		return evaluator.FALSE, true
+	}
+	return nil, false
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Branches ---------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  An if with a literal condition becomes the branch it takes. Blocks of
+  an if don't open a scope, so the statements of the branch can take the
+  place of the if statement. Used as a value, an if only folds when the
+  branch is a single expression
+*/
+func foldBranches(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.Code:
+		node.Statements = spliceBranches(node.Statements)
+	case *ast.BlockStatement:
+		node.Statements = spliceBranches(node.Statements)
+	case *ast.IfExpression:
+		taken, ok := takenBranch(node)
+		if !ok || taken == nil || len(taken.Statements) != 1 {
+			return node
+		}
+		if stmt, ok := taken.Statements[0].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+			return stmt.Expression
+		}
+	}
+	return node
+}
+
+/*
+  The value of a statement list is the value of its last statement, so a
+  last if is only replaced when that doesn't change: by a branch that
+  ends with an expression. One that ends with a let gives the if the
+  value null, the let itself gives no value
+*/
+func spliceBranches(statements []ast.Statement) []ast.Statement {
+	result := []ast.Statement{}
+	for i, statement := range statements {
+		stmt, ok := statement.(*ast.ExpressionStatement)
+		if !ok {
+			result = append(result, statement)
+			continue
+		}
+		ifExp, ok := stmt.Expression.(*ast.IfExpression)
+		if !ok {
+			result = append(result, statement)
+			continue
+		}
+		taken, ok := takenBranch(ifExp)
+		last := i == len(statements)-1
+		switch {
+		case !ok:
+			result = append(result, statement)
+		case taken == nil && !last:
+			// nothing runs and the value is not used
+		case taken == nil || last && !endsInExpression(taken):
+			result = append(result, statement)
+		default:
+			result = append(result, taken.Statements...)
+		}
+	}
+	return result
+}
+
+func endsInExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+/* The branch a literal condition selects, nil when there is none */
+func takenBranch(node *ast.IfExpression) (*ast.BlockStatement, bool) {
+	condition, ok := literalValue(node.Condition)
+	if !ok {
+		return nil, false
+	}
+	if evaluator.IsTruthy(condition) {
+		return node.Consequence, true
+	}
+	return node.Alternative, true
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Unreachable code -------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+func dropUnreachable(node ast.Node) ast.Node {
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		return node
+	}
+	for i, statement := range block.Statements {
+		if _, ok := statement.(*ast.ReturnStatement); ok {
+			block.Statements = block.Statements[:i+1]
+			break
+		}
+	}
+	return block
+}
@@ -0,0 +1,183 @@
+package optimizer
+
+import (
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"testing"
+)
+
+func TestFoldConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 * 10", "50"},
+		{"-(-3)", "3"},
+		{"1 + 2 * 3 - x", "(7 - x)"},
+		{"x + 1 + 2", "((x + 1) + 2)"},
+		{"1 + 0.5", "1.5"},
+		{`"a" + "b" + "c"`, `"abc"`},
+		{"!true == false", "true"},
+		{"1 < 2 && 3 > 4", "false"},
+		{"false && f()", "false"},
+		{"1 || f()", "true"},
+		{"f() || true", "(f() || true)"},
+		{"1 / 0", "(1 / 0)"},
+		{"1 + true", "(1 + true)"},
+		{"let f = fn() { 2 ** 10 };", "let f = fn() 1024;"},
+		{"quote(1 + 2) + unquote(3 * 3)", "(quote((1 + 2)) + unquote(9))"},
+	}
+	for _, tt := range tests {
+		testOptimize(t, tt.input, FoldConstants, tt.expected)
+	}
+}
+
+func TestFoldBranches(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (0) { 1 } else { 2 }", "1"},
+		{"let x = if (false) { 1 } else { 2 };", "let x = 2;"},
+		{"if (true) { let a = 1; a }; a", "let a = 1;aa"},
+		{"if (false) { 1 }; 2", "2"},
+		{"2; if (false) { 1 }", "2iffalse 1"},
+		{"2; if (true) { }", "2iftrue "},
+		{"let y = if (x) { 1 } else { 2 };", "let y = ifx 1else 2;"},
+		{"if (1 > 2) { 1 } else { 2 }", "if(1 > 2) 1else 2"},
+	}
+	for _, tt := range tests {
+		testOptimize(t, tt.input, FoldBranches, tt.expected)
+	}
+
+	// constants are folded first when both passes run
+	testOptimize(t, "if (1 > 2) { 1 } else { 2 }", FoldConstants|FoldBranches, "2")
+}
+
+func TestDropUnreachable(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { return 1; 2; 3 }", "fn() return 1;"},
+		{"fn() { 1; return 2; let x = 3; }", "fn() 1return 2;"},
+		{"while (true) { if (x) { return 1; x } }", "whiletrue ifx return 1;"},
+		{"fn() { 1; 2 }", "fn() 12"},
+	}
+	for _, tt := range tests {
+		testOptimize(t, tt.input, DropUnreachable, tt.expected)
+	}
+}
+
+/*
+  Every program must give the same result with each pass on its own and
+  with all of them, errors included
+*/
+func TestSemanticEquivalence(t *testing.T) {
+	inputs := []string{
+		"5 * 10 + 2 ** 3 - 7 % 4",
+		"-(-3) + ~0 + (1 << 4)",
+		"1.5 * 2 + 1",
+		`"a" + "b" == "ab"`,
+		"1 / 0",
+		"1 + true",
+		"-true",
+		"if (1 > 2) { 1 } else { 2 }",
+		"if (false) { 1 }",
+		"let x = 5; if (true) { let x = x * 2; }; x",
+		"let f = fn(n) { if (true) { return n * 2; } n }; f(4)",
+		"let f = fn() { return 1; 2 }; f()",
+		"let f = fn(x) { if (x) { return 1; puts(2) } else { 3 } }; [f(true), f(false)]",
+		"let i = 0; while (true) { i += 1; if (i > 3 * 2) { break; } }; i",
+		"let s = 0; for (x in [1, 2 + 1]) { if (false) { continue; } s += x; }; s",
+		"let f = fn() { if (true) { } }; f()",
+		"false && missing",
+		"true && missing",
+		"1 || missing",
+		"if (true) { 1 + 2 } else { missing }",
+		"quote(1 + 2)",
+		"let x = 3; quote(unquote(x * 2) + 1)",
+		`match (2 * 3) { 6 => "six", _ => "other" }`,
+		"let a = [1, 2 * 2]; a[0] += 2 * 3; a",
+		"if (true) { let x = 1 }",
+		"if (true) { 1; let x = 2; }",
+		"let x = 1; if (false) { 2 } else { let y = x; }",
+	}
+	passSets := []Pass{FoldConstants, FoldBranches, DropUnreachable, All}
+
+	for _, input := range inputs {
+		expected := evaluate(parse(t, input))
+		for _, passes := range passSets {
+			code := parse(t, input)
+			actual := evaluate(Optimize(code, passes))
+			if actual != expected {
+				t.Errorf("passes %b change the result of %s. expected=%q [actual=%q]",
+					passes, input, expected, actual)
+			}
+		}
+	}
+}
+
+/*
+  A macro expands to quote calls at the same position each time, they
+  stay as they are and the rest of the program is still optimized
+*/
+func TestQuotesFromMacros(t *testing.T) {
+	input := "let m = macro(x) { quote(quote(unquote(x) * 2)) }; m(1 + 2); m(3); 2 * 3"
+	code := parse(t, input)
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(code, macroEnv)
+	expanded, errObj := evaluator.ExpandMacros(code, macroEnv)
+	if errObj != nil {
+		t.Fatalf("macro expansion failed: %s", errObj.Message)
+	}
+
+	expected := "quote(((1 + 2) * 2))quote((3 * 2))6"
+	if actual := Optimize(expanded.(*ast.Code), All).String(); actual != expected {
+		t.Errorf("wrong result. expected=%q [actual=%q]", expected, actual)
+	}
+}
+
+func TestOriginalIsUntouched(t *testing.T) {
+	input := "let f = fn() { if (true) { return 1 + 2; 3 } }; f()"
+	code := parse(t, input)
+	before := code.String()
+	Optimize(code, All)
+	if code.String() != before {
+		t.Errorf("original tree was modified. expected=%q [actual=%q]", before, code.String())
+	}
+}
+
+func testOptimize(t *testing.T, input string, passes Pass, expected string) {
+	t.Helper()
+	optimized := Optimize(parse(t, input), passes)
+	if optimized.String() != expected {
+		t.Errorf("wrong result for %s. expected=%q [actual=%q]", input, expected, optimized.String())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Code {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	code := p.ParseCode()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %s: %s", input, p.Errors())
+	}
+	return code
+}
+
+/* The result as the REPL prints it */
+func evaluate(code *ast.Code) string {
+	result := evaluator.Eval(code, object.NewEnvironment())
+	if result == nil {
+		return ""
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return "error: " + errObj.Message
+	}
+	return result.Inspect()
+}
@@ -0,0 +1,190 @@
+package parser
+
+import (
+	"fmt"
+	tk "gomonkey/token"
+	"sort"
+	"strings"
+)
+
+/* Stable identifiers for each kind of parse error, meant for tooling */
+type ErrorCode int
+
+const (
+	_                    ErrorCode = iota
+	ErrUnexpectedToken             // the next token is not one of the expected ones
+	ErrMissingExpression           // the current token can't start an expression
+	ErrInvalidInteger              // integer literal out of range
+	ErrIllegalToken                // the lexer could not make sense of the input
+	ErrInvalidFloat                // float literal out of range
+	ErrOutsideLoop                 // break or continue that is not inside a loop
+	ErrInvalidAssignment           // the left side of an assignment is not a name or an index
+	ErrMissingDefault              // match expression without a catch-all arm
+	ErrMisplacedExport             // export inside a block or function
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	ErrUnexpectedToken:   "unexpected-token",
+	ErrMissingExpression: "missing-expression",
+	ErrInvalidInteger:    "invalid-integer",
+	ErrIllegalToken:      "illegal-token",
+	ErrInvalidFloat:      "invalid-float",
+	ErrOutsideLoop:       "outside-loop",
+	ErrInvalidAssignment: "invalid-assignment",
+	ErrMissingDefault:    "missing-default",
+	ErrMisplacedExport:   "misplaced-export",
+}
+
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("error-%d", int(c))
+}
+
+/*
+  A single parser diagnostic. Expected holds the token types that would
+  have been accepted at Pos, it is empty when the error is not about a
+  specific token (eg. an integer that overflows)
+*/
+type ParseError struct {
+	Pos      tk.Position
+	Code     ErrorCode
+	Expected []tk.TokenType
+	Actual   tk.Token
+	Msg      string
+}
+
+func (e *ParseError) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+/*
+  All the errors found while parsing, in the order they were reported.
+  ErrorList implements sort.Interface and orders errors by position
+*/
+type ErrorList []*ParseError
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l ErrorList) Less(i, j int) bool {
+	if l[i].Pos.Offset != l[j].Pos.Offset {
+		return l[i].Pos.Offset < l[j].Pos.Offset
+	}
+	return l[i].Code < l[j].Code
+}
+
+func (l ErrorList) Sort() {
+	sort.Stable(l)
+}
+
+/* Keeps only the errors for which keep returns true */
+func (l ErrorList) Filter(keep func(*ParseError) bool) ErrorList {
+	filtered := ErrorList{}
+	for _, err := range l {
+		if keep(err) {
+			filtered = append(filtered, err)
+		}
+	}
+	return filtered
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+/* Returns nil when there are no errors so callers can do 'if err != nil' */
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Recovery ---------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  Panic mode recovery: skips tokens until the end of the broken statement,
+  which is a ';', the token before a '}' or a statement keyword, or the end of
+  the input. Only boundaries at the brace depth the statement started at
+  (base) count, so braces opened inside the statement are skipped as a
+  whole. Returns true when it stopped on a '}' that closes the enclosing
+  block, the caller must not advance past it. Stray '}' outside of any
+  block are skipped along with the rest of their statement, a run of them
+  counts as one mistake
+*/
+func (p *Parser) synchronize(base int) bool {
+	for !p.curIs(tk.EOF) {
+		if p.depth < base {
+			if p.blockDepth > 0 {
+				return true
+			}
+			base = p.depth
+		}
+		if p.depth == base {
+			if p.curIs(tk.SCLN) {
+				return false
+			}
+			switch p.next.Type {
+			case tk.LET, tk.RET, tk.WHILE, tk.FOR, tk.BREAK, tk.CONT, tk.IMPORT, tk.EXPORT, tk.EOF:
+				return false
+			case tk.RBRA:
+				if p.blockDepth > 0 {
+					return false
+				}
+			}
+		}
+		p.advance()
+	}
+	return false
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Messages ---------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+func describeType(t tk.TokenType) string {
+	switch t {
+	case tk.IDN:
+		return "identifier"
+	case tk.INT:
+		return "integer"
+	case tk.FLOAT:
+		return "float"
+	case tk.STRING:
+		return "string"
+	case tk.EOF:
+		return "end of input"
+	case tk.RET:
+		return "'return'"
+	case tk.FNCT:
+		return "'fn'"
+	}
+	return "'" + string(t) + "'"
+}
+
+func describeToken(tok tk.Token) string {
+	switch tok.Type {
+	case tk.IDN, tk.INT, tk.FLOAT:
+		return fmt.Sprintf("%s '%s'", describeType(tok.Type), tok.Literal)
+	case tk.ERR:
+		return fmt.Sprintf("illegal token '%s'", tok.Literal)
+	}
+	return describeType(tok.Type)
+}
+
+func describeExpected(expected []tk.TokenType) string {
+	names := []string{}
+	for _, t := range expected {
+		names = append(names, describeType(t))
+	}
+	return strings.Join(names, " or ")
+}
@@ -0,0 +1,415 @@
+package parser
+
+import (
+	"gomonkey/lexer"
+	tk "gomonkey/token"
+	"sort"
+	"testing"
+)
+
+func TestParseErrorDetails(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedCode     ErrorCode
+		expectedExpected []tk.TokenType
+		expectedActual   tk.TokenType
+		expectedMessage  string
+	}{
+		{"let x 5;", ErrUnexpectedToken, []tk.TokenType{tk.AGMT}, tk.INT,
+			"1:7: expected '=', found integer '5'"},
+		{"let = 5;", ErrUnexpectedToken, []tk.TokenType{tk.IDN}, tk.AGMT,
+			"1:5: expected identifier, found '='"},
+		{"if (x { x }", ErrUnexpectedToken, []tk.TokenType{tk.RPAR}, tk.LBRA,
+			"1:7: expected ')', found '{'"},
+		{"fn(x) x", ErrUnexpectedToken, []tk.TokenType{tk.LBRA}, tk.IDN,
+			"1:7: expected '{', found identifier 'x'"},
+		{"let a = ;", ErrMissingExpression, nil, tk.SCLN,
+			"1:9: expected expression, found ';'"},
+		{"5 +", ErrMissingExpression, nil, tk.EOF,
+			"1:4: expected expression, found end of input"},
+		{"99999999999999999999", ErrInvalidInteger, nil, tk.INT,
+			"1:1: integer literal 99999999999999999999 is out of range"},
+		{"0x1_0000_0000_0000_0000", ErrInvalidInteger, nil, tk.INT,
+			"1:1: integer literal 0x1_0000_0000_0000_0000 is out of range"},
+		{"1e400", ErrInvalidFloat, nil, tk.FLOAT,
+			"1:1: float literal 1e400 is out of range"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		err := p.Errors()[0]
+		if err.Code != tt.expectedCode {
+			t.Errorf("wrong code for %q. expected=%s [actual=%s]",
+				tt.input, tt.expectedCode, err.Code)
+		}
+		if len(err.Expected) != len(tt.expectedExpected) {
+			t.Errorf("wrong expected set for %q. expected=%v [actual=%v]",
+				tt.input, tt.expectedExpected, err.Expected)
+		}
+		for i, typ := range tt.expectedExpected {
+			if i < len(err.Expected) && err.Expected[i] != typ {
+				t.Errorf("wrong expected set for %q. expected=%v [actual=%v]",
+					tt.input, tt.expectedExpected, err.Expected)
+			}
+		}
+		if err.Actual.Type != tt.expectedActual {
+			t.Errorf("wrong actual token for %q. expected=%s [actual=%s]",
+				tt.input, tt.expectedActual, err.Actual.Type)
+		}
+		if err.Error() != tt.expectedMessage {
+			t.Errorf("wrong message. expected=%q [actual=%q]",
+				tt.expectedMessage, err.Error())
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	list := ErrorList{
+		{Pos: tk.Position{Offset: 20, Line: 2, Column: 3}, Code: ErrMissingExpression, Msg: "b"},
+		{Pos: tk.Position{Offset: 4, Line: 1, Column: 5}, Code: ErrUnexpectedToken, Msg: "a"},
+	}
+
+	var err error = list
+	if err.Error() != "2:3: b (and 1 more errors)" {
+		t.Errorf("wrong list message [actual=%q]", err.Error())
+	}
+
+	list.Sort()
+	if !sort.IsSorted(list) || list[0].Msg != "a" {
+		t.Errorf("list not sorted by position [actual=%v]", list)
+	}
+
+	filtered := list.Filter(func(e *ParseError) bool {
+		return e.Code == ErrMissingExpression
+	})
+	if len(filtered) != 1 || filtered[0].Msg != "b" {
+		t.Errorf("wrong filtered list [actual=%v]", filtered)
+	}
+
+	if (ErrorList{}).Err() != nil {
+		t.Errorf("empty list should not be an error")
+	}
+	if list.Err() == nil {
+		t.Errorf("non empty list should be an error")
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements []string
+	}{
+		{
+			"let x 5; let y = 10;",
+			[]string{"1:7: expected '=', found integer '5'"},
+			[]string{"<bad statement>", "let y = 10;"},
+		},
+		{
+			"let = 5 * (3 + ; let y = 10; y",
+			[]string{"1:5: expected identifier, found '='"},
+			[]string{"<bad statement>", "let y = 10;", "y"},
+		},
+		{
+			"if (x { x } let y = 1;",
+			[]string{"1:7: expected ')', found '{'"},
+			[]string{"<bad statement>", "let y = 1;"},
+		},
+		{
+			"let x 1;\nlet y = ;\nlet z = 3;\nreturn );",
+			[]string{
+				"1:7: expected '=', found integer '1'",
+				"2:9: expected expression, found ';'",
+				"4:8: expected expression, found ')'",
+			},
+			[]string{"<bad statement>", "<bad statement>", "let z = 3;", "<bad statement>"},
+		},
+		{
+			"let f = fn(a) { let = a; a + }; let b = 2;",
+			[]string{
+				"1:21: expected identifier, found '='",
+				"1:30: expected expression, found '}'",
+			},
+			[]string{"let f = fn(a) <bad statement><bad statement>;", "let b = 2;"},
+		},
+		{
+			`let h = {"a" 1, "b": {}}; let b = 2;`,
+			[]string{"1:14: expected ':', found integer '1'"},
+			[]string{"<bad statement>", "let b = 2;"},
+		},
+		{
+			"} let a = 1;",
+			[]string{"1:1: expected expression, found '}'"},
+			[]string{"<bad statement>", "let a = 1;"},
+		},
+		{
+			"let x = 1; }; let y = 2;",
+			[]string{"1:12: expected expression, found '}'"},
+			[]string{"let x = 1;", "<bad statement>", "let y = 2;"},
+		},
+		{
+			"let x = (1 + }; let y = 2;",
+			[]string{"1:14: expected expression, found '}'"},
+			[]string{"<bad statement>", "let y = 2;"},
+		},
+		{
+			"}} let a = 1;",
+			[]string{"1:1: expected expression, found '}'"},
+			[]string{"<bad statement>", "let a = 1;"},
+		},
+		{
+			"let x = 3 }} let y = 1;",
+			[]string{"1:11: expected expression, found '}'"},
+			[]string{"let x = 3;", "<bad statement>", "let y = 1;"},
+		},
+		{
+			"while (true) { let x 5 break; }",
+			[]string{"1:22: expected '=', found integer '5'"},
+			[]string{"whiletrue <bad statement>break;"},
+		},
+		{
+			"for (i in a) { let x 5 continue }; let y = 1;",
+			[]string{"1:22: expected '=', found integer '5'"},
+			[]string{"for (i in a) <bad statement>continue;", "let y = 1;"},
+		},
+		{
+			"let f = fn(a) { a + 1",
+			[]string{"1:22: expected '}', found end of input"},
+			[]string{"<bad statement>"},
+		},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		code := p.ParseCode()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%d [actual=%d: %v]",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i].Error() != msg {
+				t.Errorf("wrong error. expected=%q [actual=%q]", msg, errors[i].Error())
+			}
+		}
+
+		if len(code.Statements) != len(tt.expectedStatements) {
+			t.Errorf("wrong number of statements for %q. expected=%d [actual=%d]",
+				tt.input, len(tt.expectedStatements), len(code.Statements))
+			continue
+		}
+		for i, str := range tt.expectedStatements {
+			if code.Statements[i].String() != str {
+				t.Errorf("wrong statement. expected=%q [actual=%q]",
+					str, code.Statements[i].String())
+			}
+		}
+	}
+}
+
+func TestLexerErrorsAreReported(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let s = \"abc;\nlet t = 1;", "1:9: unterminated string literal"},
+		{`let s = "a\qb"; let t = 1;`, `1:11: unknown escape sequence \q`},
+		{"let a = 1 # 2;", "1:11: illegal character '#'"},
+		{"let a = 1; /* not closed", "1:12: unterminated block comment"},
+		{"let a = 0b12;", "1:9: invalid character '2' in binary literal"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected 1 error for %q [actual=%v]", tt.input, p.Errors())
+			continue
+		}
+		err := p.Errors()[0]
+		if err.Code != ErrIllegalToken || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q [actual=%s %q]",
+				tt.expected, err.Code, err.Error())
+		}
+	}
+}
+
+/* Parameters and call arguments both allow one trailing comma, no more */
+func TestParameterListErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+	}{
+		{"fn(a, 1) { a }; let y = 1;", []string{"1:7: expected identifier, found integer '1'"}},
+		{"fn(a, b + 1) { a }", []string{"1:9: expected ')', found '+'"}},
+		{"fn(1) { }", []string{"1:4: expected identifier, found integer '1'"}},
+		{"fn(a,,) { a }", []string{"1:6: expected identifier, found ','"}},
+		{"fn(,) { }", []string{"1:4: expected identifier, found ','"}},
+		{"macro(a, {}) { a }", []string{"1:10: expected identifier, found '{'"}},
+		{"f(a,,)", []string{"1:5: expected expression, found ','"}},
+		{"f(,)", []string{"1:3: expected expression, found ','"}},
+		{"fn(a,) { a }; f(a,)", []string{}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%d [actual=%d: %v]",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i].Error() != msg {
+				t.Errorf("wrong error. expected=%q [actual=%q]", msg, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a" 1}`, "1:6: expected ':', found integer '1'"},
+		{`{"a": 1 "b": 2}`, "1:9: expected ',' or '}', found string"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected 1 error for %q [actual=%v]", tt.input, p.Errors())
+			continue
+		}
+		if p.Errors()[0].Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q [actual=%q]", tt.expected, p.Errors()[0].Error())
+		}
+	}
+}
+
+/* break and continue must have a loop around them in the same function */
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"break;", []string{"1:1: 'break' outside of a loop"}},
+		{"if (true) { continue; }", []string{"1:13: 'continue' outside of a loop"}},
+		{"while (true) { let f = fn() { break; }; }",
+			[]string{"1:31: 'break' outside of a loop"}},
+		{"while (true) { let f = fn() { while (true) { break; } }; break; }", nil},
+		{"for (x in xs) { if (x) { continue; } }", nil},
+		{"for (1 in xs) { }", []string{"1:6: expected identifier, found integer '1'"}},
+		{"for (x xs) { }", []string{"1:8: expected 'in', found identifier 'xs'"}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q. expected=%d [actual=%v]",
+				tt.input, len(tt.expected), errors)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if errors[i].Error() != msg {
+				t.Errorf("wrong error. expected=%q [actual=%q]", msg, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2;", "1:3: cannot assign to 1"},
+		{"a + b = c;", "1:7: cannot assign to (a + b)"},
+		{"f() += 1;", "1:5: cannot assign to f()"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected 1 error for %q [actual=%v]", tt.input, p.Errors())
+			continue
+		}
+		err := p.Errors()[0]
+		if err.Code != ErrInvalidAssignment || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q [actual=%s %q]", tt.expected, err.Code, err.Error())
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     ErrorCode
+		expected string
+	}{
+		{`match (x) { 1 => "a", 2 => "b" }`, ErrMissingDefault,
+			"1:1: match has no default arm, add one with '_ =>'"},
+		{`match (x) {}`, ErrMissingDefault,
+			"1:1: match has no default arm, add one with '_ =>'"},
+		{`match (x) { 1 "a", _ => "b" }`, ErrUnexpectedToken,
+			"1:15: expected '=>', found string"},
+		{`match (x) { 1 + 1 => "a", _ => "b" }`, ErrUnexpectedToken,
+			"1:15: expected '=>', found '+'"},
+		{`match (x) { fn => 1 }`, ErrUnexpectedToken,
+			"1:13: expected pattern, found 'fn'"},
+		{`match (x) { {k: 1} => 1, _ => 2 }`, ErrUnexpectedToken,
+			"1:14: expected string or integer, found identifier 'k'"},
+		{`match (x) { 1 => 1 _ => 2 }`, ErrUnexpectedToken,
+			"1:20: expected ',' or '}', found identifier '_'"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected 1 error for %q [actual=%v]", tt.input, p.Errors())
+			continue
+		}
+		err := p.Errors()[0]
+		if err.Code != tt.code || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%s %q [actual=%s %q]",
+				tt.code, tt.expected, err.Code, err.Error())
+		}
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     ErrorCode
+		expected string
+	}{
+		{`fn() { export let x = 1; }`, ErrMisplacedExport,
+			"1:8: 'export' is only allowed at the top level"},
+		{`if (true) { export let x = 1; }`, ErrMisplacedExport,
+			"1:13: 'export' is only allowed at the top level"},
+		{`export x;`, ErrUnexpectedToken, "1:8: expected 'let', found identifier 'x'"},
+		{`import "a"`, ErrUnexpectedToken, "1:11: expected 'as', found end of input"},
+		{`import x as y;`, ErrUnexpectedToken, "1:8: expected string, found identifier 'x'"},
+		{`import "a" as 1;`, ErrUnexpectedToken, "1:15: expected identifier, found integer '1'"},
+		{`a.1`, ErrUnexpectedToken, "1:3: expected identifier, found integer '1'"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseCode()
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected 1 error for %q [actual=%v]", tt.input, p.Errors())
+			continue
+		}
+		err := p.Errors()[0]
+		if err.Code != tt.code || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%s %q [actual=%s %q]",
+				tt.code, tt.expected, err.Code, err.Error())
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"gomonkey/lexer"
 	tk "gomonkey/token"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
@@ -14,7 +15,21 @@ type Parser struct {
 	cur  tk.Token
 	next tk.Token
 
-	errors []string
+	errors ErrorList
+
+	// Set by the first error in a statement, further errors are dropped
+	// until the parser resynchronizes at a statement boundary
+	panicking bool
+	// Set when resynchronizing stopped on the '}' closing the current block
+	atBlockEnd bool
+	// Number of '{' minus number of '}' seen up to and including cur
+	depth int
+	// Number of block statements being parsed around cur, a '}' seen when
+	// it's zero is a stray one
+	blockDepth int
+	// Number of loops around cur in the current function body, break and
+	// continue are only allowed when it's above zero
+	loopDepth int
 
 	prefixParseFns map[tk.TokenType]prefixParseFn
 	infixParseFns  map[tk.TokenType]infixParseFn
@@ -23,12 +38,21 @@ type Parser struct {
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or += (right associative, a = b = 1 is a = (b = 1))
+	OR          // ||
+	AND         // &&
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
 	EQUALS      // ==
 	LESSGREATER // > or <
+	SHIFT       // << or >>
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // * / %
 	PREFIX      // -X or !X
+	POWER       // ** (right associative, -2 ** 2 is -(2 ** 2))
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 // Pratt Parser Implementation
@@ -36,7 +60,7 @@ type prefixParseFn func() ast.Expression
 type infixParseFn func(ast.Expression) ast.Expression
 
 func New(l *lexer.Lexer) *Parser {
-	parser := &Parser{lexer: l, errors: []string{}}
+	parser := &Parser{lexer: l, errors: ErrorList{}}
 	parser.advance()
 	parser.advance()
 	parser.registerCallbacks()
@@ -47,37 +71,81 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) registerCallbacks() {
 	p.prefixParseFns = make(map[tk.TokenType]prefixParseFn)
 	p.prefixParseFns[tk.BANG] = p.parsePrefixExpression
+	p.prefixParseFns[tk.ERR] = p.parseIllegal
 	p.prefixParseFns[tk.FALS] = p.parseBoolean
+	p.prefixParseFns[tk.FLOAT] = p.parseFloatLiteral
 	p.prefixParseFns[tk.FNCT] = p.parseFunction
 	p.prefixParseFns[tk.IDN] = p.parseIdentifier
 	p.prefixParseFns[tk.IF] = p.parseIfExpression
 	p.prefixParseFns[tk.INT] = p.parseIntegerLiteral
+	p.prefixParseFns[tk.LBRA] = p.parseHashLiteral
+	p.prefixParseFns[tk.LBRK] = p.parseArrayLiteral
 	p.prefixParseFns[tk.LPAR] = p.parseGroupedExpression
+	p.prefixParseFns[tk.MACRO] = p.parseMacroLiteral
+	p.prefixParseFns[tk.MATCH] = p.parseMatchExpression
 	p.prefixParseFns[tk.MINS] = p.parsePrefixExpression
+	p.prefixParseFns[tk.STRING] = p.parseStringLiteral
+	p.prefixParseFns[tk.TILDE] = p.parsePrefixExpression
 	p.prefixParseFns[tk.TRUE] = p.parseBoolean
 
 	p.infixParseFns = make(map[tk.TokenType]infixParseFn)
+	p.infixParseFns[tk.AGMT] = p.parseAssignExpression
+	p.infixParseFns[tk.AND] = p.parseInfixExpression
 	p.infixParseFns[tk.ASTK] = p.parseInfixExpression
+	p.infixParseFns[tk.ASTKEQ] = p.parseAssignExpression
+	p.infixParseFns[tk.BAND] = p.parseInfixExpression
+	p.infixParseFns[tk.BOR] = p.parseInfixExpression
 	p.infixParseFns[tk.DIV] = p.parseInfixExpression
+	p.infixParseFns[tk.DIVEQ] = p.parseAssignExpression
+	p.infixParseFns[tk.DOT] = p.parseMemberExpression
 	p.infixParseFns[tk.EQ] = p.parseInfixExpression
 	p.infixParseFns[tk.GT] = p.parseInfixExpression
+	p.infixParseFns[tk.GTE] = p.parseInfixExpression
+	p.infixParseFns[tk.LBRK] = p.parseIndexExpression
 	p.infixParseFns[tk.LPAR] = p.parseCallExpression
 	p.infixParseFns[tk.LT] = p.parseInfixExpression
+	p.infixParseFns[tk.LTE] = p.parseInfixExpression
 	p.infixParseFns[tk.MINS] = p.parseInfixExpression
+	p.infixParseFns[tk.MINSEQ] = p.parseAssignExpression
+	p.infixParseFns[tk.MOD] = p.parseInfixExpression
 	p.infixParseFns[tk.NEQ] = p.parseInfixExpression
+	p.infixParseFns[tk.OR] = p.parseInfixExpression
 	p.infixParseFns[tk.PLUS] = p.parseInfixExpression
+	p.infixParseFns[tk.PLUSEQ] = p.parseAssignExpression
+	p.infixParseFns[tk.POW] = p.parseInfixExpression
+	p.infixParseFns[tk.SHL] = p.parseInfixExpression
+	p.infixParseFns[tk.SHR] = p.parseInfixExpression
+	p.infixParseFns[tk.XOR] = p.parseInfixExpression
 }
 
 var precedences = map[tk.TokenType]int{
-	tk.EQ:   EQUALS,
-	tk.NEQ:  EQUALS,
-	tk.LT:   LESSGREATER,
-	tk.GT:   LESSGREATER,
-	tk.PLUS: SUM,
-	tk.MINS: SUM,
-	tk.DIV:  PRODUCT,
-	tk.ASTK: PRODUCT,
-	tk.LPAR: CALL,
+	tk.AGMT:   ASSIGN,
+	tk.PLUSEQ: ASSIGN,
+	tk.MINSEQ: ASSIGN,
+	tk.ASTKEQ: ASSIGN,
+	tk.DIVEQ:  ASSIGN,
+	tk.OR:     OR,
+	tk.AND:    AND,
+	tk.BOR:    BITOR,
+	tk.XOR:    BITXOR,
+	tk.BAND:   BITAND,
+	tk.EQ:     EQUALS,
+	tk.NEQ:    EQUALS,
+	tk.LT:     LESSGREATER,
+	tk.GT:     LESSGREATER,
+	tk.LTE:    LESSGREATER,
+	tk.GTE:    LESSGREATER,
+	tk.SHL:    SHIFT,
+	tk.SHR:    SHIFT,
+	tk.PLUS:   SUM,
+	tk.MINS:   SUM,
+	tk.DIV:    PRODUCT,
+	tk.ASTK:   PRODUCT,
+	tk.MOD:    PRODUCT,
+	tk.POW:    POWER,
+	tk.LPAR:   CALL,
+	tk.LBRK:   INDEX,
+	tk.DOT:    INDEX,
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -114,28 +182,98 @@ func (p *Parser) ParseCode() *ast.Code {
 // Function Calls
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.cur, Function: function}
-	exp.Arguments = p.parseCallArguments()
+	exp.Arguments = p.parseExpressionList(tk.RPAR)
 	return exp
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
-	if p.nextIs(tk.RPAR) {
+/*
+  Comma separated expressions up to the closing 'end' token, used for
+  call arguments and array elements. A trailing comma is allowed
+*/
+func (p *Parser) parseExpressionList(end tk.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+	if p.nextIs(end) {
 		p.advance()
-		return args
+		return list
 	}
 	p.advance()
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 	for p.nextIs(tk.COM) {
 		p.advance()
+		if p.nextIs(end) {
+			break
+		}
 		p.advance()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
-	if !p.advanceIfNextIs(tk.RPAR) {
+	if !p.advanceIfNextIs(end) {
 		return nil
 	}
 
-	return args
+	return list
+}
+
+// Arrays
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.cur}
+	array.Elements = p.parseExpressionList(tk.RBRK)
+	return array
+}
+
+/*
+  Hash literals. Blocks are only ever parsed right after 'if', 'else' or
+  'fn(...)', so a '{' in prefix position always starts a hash
+  {"name": "x", 1: true}
+*/
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.cur}
+	hash.Pairs = []ast.HashPair{}
+
+	for !p.nextIs(tk.RBRA) {
+		p.advance()
+		key := p.parseExpression(LOWEST)
+
+		if !p.advanceIfNextIs(tk.CLN) {
+			return nil
+		}
+
+		p.advance()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.nextIs(tk.RBRA) && !p.advanceIfNextIs(tk.COM, tk.RBRA) {
+			return nil
+		}
+	}
+
+	p.advance()
+	return hash
+}
+
+/* module.name, the name after the dot is taken as is and never evaluated */
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.cur, Object: left}
+
+	if !p.advanceIfNextIs(tk.IDN) {
+		return nil
+	}
+	exp.Member = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+
+	return exp
+}
+
+/* array[index], binds tighter than a call so f(x)[0] indexes the result */
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.cur, Left: left}
+
+	p.advance()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.advanceIfNextIs(tk.RBRK) {
+		return nil
+	}
+
+	return exp
 }
 
 /*
@@ -152,7 +290,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 
 	leftExpression := prefixFn()
-	for p.next.Type != tk.SCLN && precedence < p.peekPrecedence() {
+	for !p.panicking && p.next.Type != tk.SCLN && precedence < p.peekPrecedence() {
 		infixFn := p.infixParseFns[p.next.Type]
 		if infixFn == nil {
 			return leftExpression
@@ -174,12 +312,38 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	infixExp.Left = left
 
 	precedence := precedences[p.cur.Type]
+	if p.curIs(tk.POW) {
+		// a lower binding power on the right makes 2 ** 3 ** 2 group as 2 ** (3 ** 2)
+		precedence--
+	}
 	p.advance()
 	infixExp.Right = p.parseExpression(precedence)
 
 	return infixExp
 }
 
+/* Only names and index expressions can be assigned to */
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	assign := &ast.AssignExpression{Token: p.cur, Target: target, Operator: p.cur.Literal}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.addError(&ParseError{
+			Pos:    p.cur.Pos,
+			Code:   ErrInvalidAssignment,
+			Actual: p.cur,
+			Msg:    fmt.Sprintf("cannot assign to %s", target.String()),
+		})
+		return nil
+	}
+
+	p.advance()
+	assign.Value = p.parseExpression(ASSIGN - 1)
+
+	return assign
+}
+
 // Prefix operators
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	//defer untrace(trace("parsePrefixExpression"))
@@ -230,6 +394,11 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.nextIs(tk.ELSE) {
 		p.advance()
 
+		if p.nextIs(tk.IF) {
+			expression.Alternative = p.parseElseIf()
+			return expression
+		}
+
 		if !p.advanceIfNextIs(tk.LBRA) {
 			return nil
 		}
@@ -240,6 +409,186 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+/*
+  'else if (...) {...}' is sugar for 'else { if (...) {...} }', the chain
+  becomes an alternative block holding a single if expression
+*/
+func (p *Parser) parseElseIf() *ast.BlockStatement {
+	p.advance()
+	block := &ast.BlockStatement{Token: p.cur}
+	stmt := &ast.ExpressionStatement{Token: p.cur}
+	stmt.Expression = p.parseIfExpression()
+	block.Statements = []ast.Statement{stmt}
+	return block
+}
+
+/*
+  match (subject) { pattern => expression, ... }
+  Arms are separated by commas, a trailing comma is allowed. Every match
+  needs a default arm (_ or a name) so that some arm always applies
+*/
+func (p *Parser) parseMatchExpression() ast.Expression {
+	match := &ast.MatchExpression{Token: p.cur}
+
+	if !p.advanceIfNextIs(tk.LPAR) {
+		return nil
+	}
+
+	p.advance()
+	match.Subject = p.parseExpression(LOWEST)
+
+	if !p.advanceIfNextIs(tk.RPAR) {
+		return nil
+	}
+
+	if !p.advanceIfNextIs(tk.LBRA) {
+		return nil
+	}
+
+	hasDefault := false
+	for !p.nextIs(tk.RBRA) {
+		p.advance()
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+		switch arm.Pattern.(type) {
+		case *ast.WildcardPattern, *ast.BindingPattern:
+			hasDefault = true
+		}
+
+		if !p.advanceIfNextIs(tk.ARROW) {
+			return nil
+		}
+		arm.Token = p.cur
+
+		p.advance()
+		arm.Body = p.parseExpression(LOWEST)
+		if arm.Body == nil {
+			return nil
+		}
+		match.Arms = append(match.Arms, arm)
+
+		if !p.nextIs(tk.RBRA) && !p.advanceIfNextIs(tk.COM, tk.RBRA) {
+			return nil
+		}
+	}
+	p.advance()
+
+	if !hasDefault {
+		p.addError(&ParseError{
+			Pos:    match.Token.Pos,
+			Code:   ErrMissingDefault,
+			Actual: match.Token,
+			Msg:    "match has no default arm, add one with '_ =>'",
+		})
+		return nil
+	}
+	return match
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.cur.Type {
+	case tk.IDN:
+		if p.cur.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.cur}
+		}
+		return &ast.BindingPattern{Name: &ast.Identifier{Token: p.cur, Value: p.cur.Literal}}
+
+	case tk.INT, tk.FLOAT, tk.STRING, tk.TRUE, tk.FALS:
+		value := p.prefixParseFns[p.cur.Type]()
+		if value == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Value: value}
+
+	case tk.MINS:
+		minus := &ast.PrefixExpression{Token: p.cur, Operator: p.cur.Literal}
+		if !p.nextIs(tk.INT) && !p.nextIs(tk.FLOAT) {
+			p.peekError(tk.INT, tk.FLOAT)
+			return nil
+		}
+		p.advance()
+		minus.Right = p.prefixParseFns[p.cur.Type]()
+		if minus.Right == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Value: minus}
+
+	case tk.LBRK:
+		return p.parseArrayPattern()
+
+	case tk.LBRA:
+		return p.parseHashPattern()
+	}
+
+	p.addError(&ParseError{
+		Pos:    p.cur.Pos,
+		Code:   ErrUnexpectedToken,
+		Actual: p.cur,
+		Msg:    fmt.Sprintf("expected pattern, found %s", describeToken(p.cur)),
+	})
+	return nil
+}
+
+/* [a, 1, _], a trailing comma is allowed */
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.cur}
+
+	for !p.nextIs(tk.RBRK) {
+		p.advance()
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.nextIs(tk.RBRK) && !p.advanceIfNextIs(tk.COM, tk.RBRK) {
+			return nil
+		}
+	}
+	p.advance()
+
+	return pattern
+}
+
+/* {"key": pattern, 1: pattern}, keys are literals */
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.cur}
+
+	for !p.nextIs(tk.RBRA) {
+		p.advance()
+		var key ast.Expression
+		switch p.cur.Type {
+		case tk.STRING, tk.INT, tk.TRUE, tk.FALS:
+			key = p.prefixParseFns[p.cur.Type]()
+		default:
+			p.unexpectedTokenError(p.cur, tk.STRING, tk.INT)
+		}
+		if key == nil {
+			return nil
+		}
+
+		if !p.advanceIfNextIs(tk.CLN) {
+			return nil
+		}
+
+		p.advance()
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, ast.HashPatternPair{Key: key, Value: value})
+
+		if !p.nextIs(tk.RBRA) && !p.advanceIfNextIs(tk.COM, tk.RBRA) {
+			return nil
+		}
+	}
+	p.advance()
+
+	return pattern
+}
+
 func (p *Parser) parseIfExpression2() ast.Expression {
 	expression := &ast.IfExpression{Token: p.cur}
 	if !p.advanceIf(tk.LPAR) {
@@ -276,15 +625,45 @@ func (p *Parser) parseFunction() ast.Expression {
 
 	fnLit.Parameters = p.parseFunctionParameters()
 
-	if !p.advanceIfNextIs(tk.LBRA) {
+	if p.panicking || !p.advanceIfNextIs(tk.LBRA) {
 		return nil
 	}
 
+	// a loop around the function literal doesn't make break legal inside it
+	outerLoops := p.loopDepth
+	p.loopDepth = 0
 	fnLit.Body = p.parseBlockStatement()
+	p.loopDepth = outerLoops
 
 	return fnLit
 }
 
+/* Same shape as a function literal, only 'macro' instead of 'fn' */
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.cur}
+
+	if !p.advanceIfNextIs(tk.LPAR) {
+		return nil
+	}
+
+	macro.Parameters = p.parseFunctionParameters()
+
+	if p.panicking || !p.advanceIfNextIs(tk.LBRA) {
+		return nil
+	}
+
+	outerLoops := p.loopDepth
+	p.loopDepth = 0
+	macro.Body = p.parseBlockStatement()
+	p.loopDepth = outerLoops
+
+	return macro
+}
+
+/*
+  Parameters are plain names. Like call arguments, the list may end with
+  a comma: fn(a, b,) { ... }
+*/
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 	if p.nextIs(tk.RPAR) {
@@ -292,16 +671,20 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return nil
 	}
 
-	p.advance()
-
-	identifier := &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
-	identifiers = append(identifiers, identifier)
+	if !p.advanceIfNextIs(tk.IDN) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.cur, Value: p.cur.Literal})
 
 	for p.nextIs(tk.COM) {
 		p.advance()
-		p.advance()
-		identifier := &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
-		identifiers = append(identifiers, identifier)
+		if p.nextIs(tk.RPAR) {
+			break
+		}
+		if !p.advanceIfNextIs(tk.IDN) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.cur, Value: p.cur.Literal})
 	}
 
 	if !p.advanceIfNextIs(tk.RPAR) {
@@ -309,20 +692,35 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	}
 
 	return identifiers
-
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
 }
 
+/*
+  Prefixed literals (0x, 0o, 0b) go through ParseInt's base detection. A
+  plain decimal is always base 10, a leading zero does not make it octal
+*/
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	intlit := &ast.IntegerLiteral{Token: p.cur}
 
-	value, err := strconv.ParseInt(p.cur.Literal, 0, 64)
+	lit := p.cur.Literal
+	base := 10
+	if len(lit) > 1 && lit[0] == '0' && !isDecimalDigit(lit[1]) && lit[1] != '_' {
+		base = 0
+	} else {
+		lit = strings.ReplaceAll(lit, "_", "")
+	}
+
+	value, err := strconv.ParseInt(lit, base, 64)
 	if err != nil {
-		msg := fmt.Sprintf("Error: Integer not valid [Value=%q]", p.cur.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(&ParseError{
+			Pos:    p.cur.Pos,
+			Code:   ErrInvalidInteger,
+			Actual: p.cur,
+			Msg:    fmt.Sprintf("integer literal %s is out of range", p.cur.Literal),
+		})
 		return nil
 	}
 
@@ -330,6 +728,49 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return intlit
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	floatlit := &ast.FloatLiteral{Token: p.cur}
+
+	value, err := strconv.ParseFloat(p.cur.Literal, 64)
+	if err != nil {
+		p.addError(&ParseError{
+			Pos:    p.cur.Pos,
+			Code:   ErrInvalidFloat,
+			Actual: p.cur,
+			Msg:    fmt.Sprintf("float literal %s is out of range", p.cur.Literal),
+		})
+		return nil
+	}
+
+	floatlit.Value = value
+	return floatlit
+}
+
+func isDecimalDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.cur, Value: p.cur.Literal}
+}
+
+/* ERR tokens, the lexer knows what went wrong with them */
+func (p *Parser) parseIllegal() ast.Expression {
+	msg := fmt.Sprintf("illegal token %q", p.cur.Literal)
+	pos := p.cur.Pos
+	if lexErr, ok := p.lexer.ErrorAt(p.cur.Pos); ok {
+		msg = lexErr.Msg
+		pos = lexErr.Pos
+	}
+	p.addError(&ParseError{
+		Pos:    pos,
+		Code:   ErrIllegalToken,
+		Actual: p.cur,
+		Msg:    msg,
+	})
+	return nil
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.cur, Value: p.cur.Type == tk.TRUE}
 }
@@ -339,27 +780,40 @@ func (p *Parser) advanceIf(t tk.TokenType) bool {
 		p.advance()
 		return true
 	}
-	p.addPeekError(t)
+	p.peekError(t)
 	return false
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() ErrorList {
 	return p.errors
 }
 
-func (p *Parser) addPeekError(tok tk.TokenType) {
-	err := fmt.Sprintf("Error: Exepected '%s' token [actual = '%s']", tok, p.next.Type)
+func (p *Parser) addError(err *ParseError) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
 	p.errors = append(p.errors, err)
 }
 
 func (p *Parser) noPrefixParseFnError(t tk.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(&ParseError{
+		Pos:    p.cur.Pos,
+		Code:   ErrMissingExpression,
+		Actual: p.cur,
+		Msg:    fmt.Sprintf("expected expression, found %s", describeToken(p.cur)),
+	})
 }
 
 func (p *Parser) advance() {
 	p.cur = p.next
 	p.next = p.lexer.NextToken()
+	switch p.cur.Type {
+	case tk.LBRA:
+		p.depth++
+	case tk.RBRA:
+		p.depth--
+	}
 }
 
 func (p *Parser) curIs(t tk.TokenType) bool {
@@ -370,37 +824,133 @@ func (p *Parser) nextIs(t tk.TokenType) bool {
 	return p.next.Type == t
 }
 
-func (p *Parser) advanceIfNextIs(t tk.TokenType) bool {
+/*
+  Advances when the next token is t. The alternatives are only used to
+  report what else would have been accepted at this point
+*/
+func (p *Parser) advanceIfNextIs(t tk.TokenType, alternatives ...tk.TokenType) bool {
 	if p.nextIs(t) {
 		p.advance()
 		return true
 	} else {
-		p.peekError(t)
+		p.peekError(append([]tk.TokenType{t}, alternatives...)...)
 		return false
 	}
 }
 
-func (p *Parser) peekError(t tk.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.next.Type)
-	p.errors = append(p.errors, msg)
+func (p *Parser) peekError(expected ...tk.TokenType) {
+	p.unexpectedTokenError(p.next, expected...)
+}
+
+func (p *Parser) unexpectedTokenError(actual tk.Token, expected ...tk.TokenType) {
+	p.addError(&ParseError{
+		Pos:      actual.Pos,
+		Code:     ErrUnexpectedToken,
+		Expected: expected,
+		Actual:   actual,
+		Msg: fmt.Sprintf("expected %s, found %s",
+			describeExpected(expected), describeToken(actual)),
+	})
 }
 
 /*  ----------------------------------------------------------- */
 /*  --- Parse Statement --------------------------------------- */
 /*  ----------------------------------------------------------- */
 
+/*
+  A statement that fails to parse is replaced by an ast.BadStatement
+  covering the tokens skipped while recovering, so the rest of the code
+  still gets parsed and checked
+*/
 func (p *Parser) parseStatement() ast.Statement {
+	from := p.cur
+	base := p.depth
+	if from.Type == tk.LBRA {
+		base--
+	}
+
+	statement := p.parseStatementKind()
+	if p.panicking {
+		p.atBlockEnd = p.synchronize(base)
+		p.panicking = false
+		return &ast.BadStatement{From: from, To: p.cur}
+	}
+	return statement
+}
+
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.cur.Type {
 	case tk.LET:
 		return p.parseLetStatement()
 	case tk.RET:
 		return p.parseReturnStatement()
+	case tk.WHILE:
+		return p.parseWhileStatement()
+	case tk.FOR:
+		return p.parseForStatement()
+	case tk.BREAK:
+		return p.parseLoopControl(&ast.BreakStatement{Token: p.cur})
+	case tk.CONT:
+		return p.parseLoopControl(&ast.ContinueStatement{Token: p.cur})
+	case tk.IMPORT:
+		return p.parseImportStatement()
+	case tk.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+/* import "path" as name; */
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.cur}
+
+	if !p.advanceIfNextIs(tk.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.cur, Value: p.cur.Literal}
+
+	if !p.advanceIfNextIs(tk.AS) {
+		return nil
+	}
+
+	if !p.advanceIfNextIs(tk.IDN) {
+		return nil
+	}
+	stmt.Alias = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+
+	if !p.panicking && p.nextIs(tk.SCLN) {
+		p.advance()
+	}
+	return stmt
+}
+
+/* export let name = value; only at the top level of a file */
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.cur}
+
+	if p.depth > 0 {
+		p.addError(&ParseError{
+			Pos:    p.cur.Pos,
+			Code:   ErrMisplacedExport,
+			Actual: p.cur,
+			Msg:    "'export' is only allowed at the top level",
+		})
+		return nil
+	}
+
+	if !p.advanceIfNextIs(tk.LET) {
+		return nil
+	}
+
+	let, ok := p.parseLetStatement().(*ast.LetStatement)
+	if !ok {
+		return nil
+	}
+	stmt.Statement = let
+	return stmt
+}
+
 func (p *Parser) parseLetStatement() ast.Statement {
 	let := &ast.LetStatement{}
 	let.Token = p.cur
@@ -420,7 +970,7 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	p.advance()
 	let.Value = p.parseExpression(LOWEST)
 
-	if p.nextIs(tk.SCLN) {
+	if !p.panicking && p.nextIs(tk.SCLN) {
 		p.advance()
 	}
 
@@ -434,20 +984,102 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 
 	ret.Value = p.parseExpression(LOWEST)
 
-	for p.nextIs(tk.SCLN) {
+	for !p.panicking && p.nextIs(tk.SCLN) {
 		p.advance()
 	}
 
 	return ret
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+	loop := &ast.WhileStatement{Token: p.cur}
+
+	if !p.advanceIfNextIs(tk.LPAR) {
+		return nil
+	}
+
+	p.advance()
+	loop.Condition = p.parseExpression(LOWEST)
+
+	if !p.advanceIfNextIs(tk.RPAR) {
+		return nil
+	}
+
+	if !p.advanceIfNextIs(tk.LBRA) {
+		return nil
+	}
+
+	loop.Body = p.parseLoopBody()
+	return loop
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	loop := &ast.ForStatement{Token: p.cur}
+
+	if !p.advanceIfNextIs(tk.LPAR) {
+		return nil
+	}
+
+	if !p.advanceIfNextIs(tk.IDN) {
+		return nil
+	}
+	loop.Variable = &ast.Identifier{Token: p.cur, Value: p.cur.Literal}
+
+	if !p.advanceIfNextIs(tk.IN) {
+		return nil
+	}
+
+	p.advance()
+	loop.Iterable = p.parseExpression(LOWEST)
+
+	if !p.advanceIfNextIs(tk.RPAR) {
+		return nil
+	}
+
+	if !p.advanceIfNextIs(tk.LBRA) {
+		return nil
+	}
+
+	loop.Body = p.parseLoopBody()
+	return loop
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+
+	if !p.panicking && p.nextIs(tk.SCLN) {
+		p.advance()
+	}
+	return body
+}
+
+/* break and continue, only valid inside a loop of the same function */
+func (p *Parser) parseLoopControl(stmt ast.Statement) ast.Statement {
+	if p.loopDepth == 0 {
+		p.addError(&ParseError{
+			Pos:    p.cur.Pos,
+			Code:   ErrOutsideLoop,
+			Actual: p.cur,
+			Msg:    fmt.Sprintf("'%s' outside of a loop", p.cur.Literal),
+		})
+		return nil
+	}
+
+	if !p.panicking && p.nextIs(tk.SCLN) {
+		p.advance()
+	}
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	exp := &ast.ExpressionStatement{}
 	exp.Token = p.cur
 
 	exp.Expression = p.parseExpression(LOWEST)
 
-	if p.next.Type == tk.SCLN {
+	if !p.panicking && p.next.Type == tk.SCLN {
 		p.advance()
 	}
 
@@ -457,13 +1089,22 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.cur}
 	block.Statements = []ast.Statement{}
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
 	p.advance()
 	for p.cur.Type != tk.RBRA && p.cur.Type != tk.EOF {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.atBlockEnd {
+			p.atBlockEnd = false
+			break
+		}
 		p.advance()
 	}
+	if p.curIs(tk.EOF) {
+		p.unexpectedTokenError(p.cur, tk.RBRA)
+	}
 	return block
 }
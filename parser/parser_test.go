@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gomonkey/ast"
 	"gomonkey/lexer"
+	"strings"
 	"testing"
 )
 
@@ -262,6 +263,110 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"a /* times */ * b // comment\n+ c",
+			"((a * b) + c)",
+		},
+		{
+			"f(x)[0]",
+			"(f(x)[0])",
+		},
+		{
+			"a[i][j]",
+			"((a[i])[j])",
+		},
+		{
+			"-a[0]",
+			"(-(a[0]))",
+		},
+		{
+			"a <= b == b >= c",
+			"((a <= b) == (b >= c))",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"2 ** -x",
+			"(2 ** (-x))",
+		},
+		{
+			"a ** b[0]",
+			"(a ** (b[0]))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"a && b | c",
+			"(a && (b | c))",
+		},
+		{
+			"1 << 2 + 3",
+			"(1 << (2 + 3))",
+		},
+		{
+			"a < b << c",
+			"(a < (b << c))",
+		},
+		{
+			"a >> b >> c",
+			"((a >> b) >> c)",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
+		{
+			"x = y = 1 + 2",
+			"(x = (y = (1 + 2)))",
+		},
+		{
+			"a[i] += b || c",
+			"((a[i]) += (b || c))",
+		},
+		{
+			"x = fn(a) { a }(1)",
+			"(x = fn(a) a(1))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -463,6 +568,7 @@ func TestFunctionParameterParsing(t *testing.T) {
 		{input: "fn() {};", expectedParams: []string{}},
 		{input: "fn(x) {};", expectedParams: []string{"x"}},
 		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+		{input: "fn(x, y,) {};", expectedParams: []string{"x", "y"}},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -585,3 +691,402 @@ func getCallExpression(code *ast.Code, stmt *ast.ExpressionStatement, t *testing
 
 	return exp
 }
+
+func TestErrorsReportPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: "},
+		{"let a = 1;\n\nlet = 2;", "3:5: "},
+		{"let a = 1;\r\n  if (a { a }", "2:9: "},
+		{"let a = 1;\n  )", "2:3: "},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseCode()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if !strings.HasPrefix(p.Errors()[0].Error(), tt.expected) {
+			t.Errorf("error does not start with %q [actual=%q]",
+				tt.expected, p.Errors()[0].Error())
+		}
+	}
+}
+
+func TestNumberLiteralExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0x1F", int64(31)},
+		{"0o17", int64(15)},
+		{"0b1010", int64(10)},
+		{"1_000_000", int64(1000000)},
+		{"010", int64(10)},
+		{"1.5", 1.5},
+		{"2e3", 2000.0},
+		{"1_000.5e-1", 100.05},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		code := p.ParseCode()
+		checkParserErrors(t, p)
+		stmt := getExpressionStatement(code, t)
+		switch expected := tt.expected.(type) {
+		case int64:
+			literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+			if !ok || literal.Value != expected {
+				t.Errorf("%s: expected integer %d [actual=%#v]", tt.input, expected, stmt.Expression)
+			}
+		case float64:
+			literal, ok := stmt.Expression.(*ast.FloatLiteral)
+			if !ok || literal.Value != expected {
+				t.Errorf("%s: expected float %g [actual=%#v]", tt.input, expected, stmt.Expression)
+			}
+		}
+		if stmt.Expression.String() != tt.input {
+			t.Errorf("String() should keep the source spelling [actual=%q]", stmt.Expression.String())
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello \"world\"";`
+	l := lexer.New(input)
+	p := New(l)
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 1)
+	stmt := getExpressionStatement(code, t)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral [actual=%T]", stmt.Expression)
+	}
+	if literal.Value != `hello "world"` {
+		t.Errorf("literal.Value not %q [actual=%q]", `hello "world"`, literal.Value)
+	}
+	if literal.String() != `"hello \"world\""` {
+		t.Errorf("literal.String() wrong [actual=%q]", literal.String())
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"[1, 2 * 2, 3 + 3]", 3},
+		{"[1, 2 * 2, 3 + 3,]", 3},
+		{"[]", 0},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		code := p.ParseCode()
+		checkParserErrors(t, p)
+		stmt := getExpressionStatement(code, t)
+		array, ok := stmt.Expression.(*ast.ArrayLiteral)
+		if !ok {
+			t.Fatalf("exp not ast.ArrayLiteral [actual=%T]", stmt.Expression)
+		}
+		if len(array.Elements) != tt.expected {
+			t.Fatalf("len(array.Elements) not %d [actual=%d]", tt.expected, len(array.Elements))
+		}
+		if tt.expected == 3 {
+			testIntegerLiteral(t, array.Elements[0], 1)
+			testInfixExpression(t, array.Elements[1], 2, "*", 2)
+			testInfixExpression(t, array.Elements[2], 3, "+", 3)
+		}
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+	l := lexer.New(input)
+	p := New(l)
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	stmt := getExpressionStatement(code, t)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression [actual=%T]", stmt.Expression)
+	}
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 2, "three": 3}`, `{"one": 1, "two": 2, "three": 3}`},
+		{`{"one": 0 + 1, "two": 10 - 8,}`, `{"one": (0 + 1), "two": (10 - 8)}`},
+		{`{1: true, true: "x", key: value}`, `{1: true, true: "x", key: value}`},
+		{`{}`, `{}`},
+		{`{"a": {"b": [1]}}["a"]`, `({"a": {"b": [1]}}["a"])`},
+		{`if (x) { {"a": 1} }`, `ifx {"a": 1}`},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		code := p.ParseCode()
+		checkParserErrors(t, p)
+		if code.String() != tt.expected {
+			t.Errorf("expected=%q [actual=%q]", tt.expected, code.String())
+		}
+	}
+}
+
+func TestParsingHashLiteralPairs(t *testing.T) {
+	input := `{"one": 1, "two": 2}`
+	l := lexer.New(input)
+	p := New(l)
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	stmt := getExpressionStatement(code, t)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral [actual=%T]", stmt.Expression)
+	}
+	expected := []struct {
+		key   string
+		value int64
+	}{{"one", 1}, {"two", 2}}
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length [actual=%d]", len(hash.Pairs))
+	}
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral [actual=%T]", pair.Key)
+			continue
+		}
+		if literal.Value != expected[i].key {
+			t.Errorf("wrong key. expected=%q [actual=%q]", expected[i].key, literal.Value)
+		}
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { if (x == 5) { break; } x; continue; }`
+	p := New(lexer.New(input))
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 1)
+
+	loop, ok := code.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.WhileStatement [actual=%T]", code.Statements[0])
+	}
+	if !testInfixExpression(t, loop.Condition, "x", "<", 10) {
+		return
+	}
+	if len(loop.Body.Statements) != 3 {
+		t.Fatalf("body does not contain 3 statements [actual=%d]", len(loop.Body.Statements))
+	}
+	if _, ok := loop.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("last statement is not *ast.ContinueStatement [actual=%T]",
+			loop.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (item in [1, 2, 3]) { puts(item); }`
+	p := New(lexer.New(input))
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 1)
+
+	loop, ok := code.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.ForStatement [actual=%T]", code.Statements[0])
+	}
+	if !testIdentifier(t, loop.Variable, "item") {
+		return
+	}
+	if loop.Iterable.String() != "[1, 2, 3]" {
+		t.Errorf("wrong iterable [actual=%q]", loop.Iterable.String())
+	}
+	if loop.String() != "for (item in [1, 2, 3]) puts(item)" {
+		t.Errorf("wrong String() [actual=%q]", loop.String())
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		target   string
+		operator string
+		value    string
+	}{
+		{"x = 5;", "x", "=", "5"},
+		{"total += n * 2;", "total", "+=", "(n * 2)"},
+		{"a[0] -= 1;", "(a[0])", "-=", "1"},
+		{`h["k"] *= 3;`, `(h["k"])`, "*=", "3"},
+		{"x /= 2;", "x", "/=", "2"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		code := p.ParseCode()
+		checkParserErrors(t, p)
+		stmt := getExpressionStatement(code, t)
+		assign, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignExpression [actual=%T]", stmt.Expression)
+		}
+		if assign.Target.String() != tt.target || assign.Operator != tt.operator ||
+			assign.Value.String() != tt.value {
+			t.Errorf("wrong assignment. expected=%s %s %s [actual=%s %s %s]",
+				tt.target, tt.operator, tt.value,
+				assign.Target.String(), assign.Operator, assign.Value.String())
+		}
+	}
+}
+
+func TestElseIfChain(t *testing.T) {
+	input := `if (x < 0) { -1 } else if (x == 0) { 0 } else if (x < 10) { 1 } else { 2 }`
+	p := New(lexer.New(input))
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 1)
+
+	exp, ok := getExpressionStatement(code, t).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IfExpression [actual=%T]", code.Statements[0])
+	}
+	depth := 1
+	for exp.Alternative != nil && len(exp.Alternative.Statements) == 1 {
+		stmt, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			break
+		}
+		next, ok := stmt.Expression.(*ast.IfExpression)
+		if !ok {
+			break
+		}
+		exp = next
+		depth++
+	}
+	if depth != 3 {
+		t.Errorf("expected 3 chained ifs [actual=%d]", depth)
+	}
+	if exp.Alternative == nil || exp.Alternative.String() != "2" {
+		t.Errorf("last else not parsed [actual=%v]", exp.Alternative)
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (v) {
+		1 => "one",
+		-2.5 => "neg",
+		"x" => "ex",
+		true => "yes",
+		[a, _, [b]] => a + b,
+		{"k": k, 1: [c]} => k + c,
+		n => n,
+	}`
+	p := New(lexer.New(input))
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 1)
+
+	match, ok := getExpressionStatement(code, t).Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MatchExpression [actual=%T]", code.Statements[0])
+	}
+	if !testIdentifier(t, match.Subject, "v") {
+		return
+	}
+	expected := []string{`1`, `(-2.5)`, `"x"`, `true`, `[a, _, [b]]`, `{"k": k, 1: [c]}`, `n`}
+	if len(match.Arms) != len(expected) {
+		t.Fatalf("expected %d arms [actual=%d]", len(expected), len(match.Arms))
+	}
+	for i, pattern := range expected {
+		if match.Arms[i].Pattern.String() != pattern {
+			t.Errorf("arms[%d] wrong pattern. expected=%q [actual=%q]",
+				i, pattern, match.Arms[i].Pattern.String())
+		}
+	}
+	if _, ok := match.Arms[6].Pattern.(*ast.BindingPattern); !ok {
+		t.Errorf("a name should be a binding pattern [actual=%T]", match.Arms[6].Pattern)
+	}
+	if match.Arms[4].Body.String() != "(a + b)" {
+		t.Errorf("wrong arm body [actual=%q]", match.Arms[4].Body.String())
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+	p := New(lexer.New(input))
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 1)
+
+	macro, ok := getExpressionStatement(code, t).Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.MacroLiteral [actual=%T]", code.Statements[0])
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2 [actual=%d]", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statement [actual=%d]", len(macro.Body.Statements))
+	}
+	body := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	testInfixExpression(t, body.Expression, "x", "+", "y")
+}
+
+func TestImportStatement(t *testing.T) {
+	input := `import "lib/strings.monkey" as s; s.upper(x);`
+	p := New(lexer.New(input))
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 2)
+
+	stmt, ok := code.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ImportStatement [actual=%T]", code.Statements[0])
+	}
+	if stmt.Path.Value != "lib/strings.monkey" {
+		t.Errorf("import path wrong [actual=%q]", stmt.Path.Value)
+	}
+	testIdentifier(t, stmt.Alias, "s")
+
+	call := getCallExpression(code, code.Statements[1].(*ast.ExpressionStatement), t)
+	member, ok := call.Function.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("call.Function not *ast.MemberExpression [actual=%T]", call.Function)
+	}
+	testIdentifier(t, member.Object, "s")
+	testIdentifier(t, member.Member, "upper")
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let add = fn(a, b) { a + b };`
+	p := New(lexer.New(input))
+	code := p.ParseCode()
+	checkParserErrors(t, p)
+	assertStatementCount(code, t, 1)
+
+	stmt, ok := code.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ExportStatement [actual=%T]", code.Statements[0])
+	}
+	testLetStatement(t, stmt.Statement, "add")
+	if stmt.String() != "export let add = fn(a, b) (a + b);" {
+		t.Errorf("stmt.String() wrong [actual=%q]", stmt.String())
+	}
+}
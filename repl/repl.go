@@ -3,8 +3,14 @@ package repl
 import (
 	"bufio"
 	"fmt"
+	"gomonkey/ast"
+	"gomonkey/compiler"
+	"gomonkey/evaluator"
 	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/optimizer"
 	"gomonkey/parser"
+	"gomonkey/vm"
 	"io"
 )
 
@@ -22,31 +28,202 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
+/* The backends that can run the code */
+type Engine string
+
+const (
+	EVAL Engine = "eval" // tree-walking evaluator
+	VM   Engine = "vm"   // bytecode compiler and virtual machine
+)
+
+/* How a program is run */
+type Options struct {
+	Engine   Engine
+	Dir      string         // imports are resolved from here
+	Trace    io.Writer      // VM only, logs the instructions of the program as they run
+	Optimize optimizer.Pass // passes run on the code after macro expansion
+}
+
+/* Runs parsed and macro-expanded code, nil means there is nothing to print */
+type runner func(program ast.Node) (object.Object, *object.Error)
+
 func Start(in io.Reader, out io.Writer) {
+	StartWithEngine(in, out, EVAL)
+}
+
+func StartWithEngine(in io.Reader, out io.Writer, engine Engine) {
+	StartWithOptions(in, out, Options{Engine: engine})
+}
+
+/*
+  Every line is run against the same state so bindings made on one line
+  are visible on the following ones. The same goes for macros, which are
+  expanded before a line is run, and imported modules
+*/
+func StartWithOptions(in io.Reader, out io.Writer, options Options) {
 	scanner := bufio.NewScanner(in)
+	run := newRunner(options)
+	macroEnv := object.NewEnvironment()
 	for {
-		fmt.Printf(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-		code := p.ParseCode()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		result, ok := runSource(scanner.Text(), macroEnv, options.Optimize, run, out)
+		if !ok || result == nil {
 			continue
 		}
-		io.WriteString(out, code.String())
+		io.WriteString(out, result.Inspect())
 		io.WriteString(out, "\n")
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+/*
+  Runs a whole program, eg. a script given on the command line. Returns
+  false when it failed, the errors have been written to out then
+*/
+func RunProgram(src string, out io.Writer, options Options) bool {
+	run := newRunner(options)
+	_, ok := runSource(src, object.NewEnvironment(), options.Optimize, run, out)
+	return ok
+}
+
+/*
+  Compiles a whole program for the VM, eg. to save it precompiled. Returns
+  false when it failed, the errors have been written to out then
+*/
+func CompileProgram(src string, out io.Writer, passes optimizer.Pass) (*compiler.Bytecode, bool) {
+	var bytecode *compiler.Bytecode
+	compile := func(program ast.Node) (object.Object, *object.Error) {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return nil, &object.Error{Message: err.Error()}
+		}
+		bytecode = comp.Bytecode()
+		return nil, nil
+	}
+	_, ok := runSource(src, object.NewEnvironment(), passes, compile, out)
+	return bytecode, ok
+}
+
+/* Runs a precompiled program on the VM, whatever options.Engine says */
+func RunBytecode(bytecode *compiler.Bytecode, out io.Writer, options Options) bool {
+	machine := vm.New(bytecode)
+	machine.SetLoader(newImporter(VM, options.Dir))
+	if options.Trace != nil {
+		machine.SetTrace(options.Trace)
+	}
+	if err := machine.Run(); err != nil {
+		printRuntimeError(out, &object.Error{Message: err.Error()})
+		return false
+	}
+	return true
+}
+
+func runSource(src string, macroEnv *object.Environment, passes optimizer.Pass, run runner, out io.Writer) (object.Object, bool) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	code := p.ParseCode()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return nil, false
+	}
+	evaluator.DefineMacros(code, macroEnv)
+	expanded, errObj := evaluator.ExpandMacros(code, macroEnv)
+	if errObj != nil {
+		printRuntimeError(out, errObj)
+		return nil, false
+	}
+
+	if passes != 0 {
+		expanded = optimizer.Optimize(expanded.(*ast.Code), passes)
+	}
+	result, errObj := run(expanded)
+	if errObj != nil {
+		printRuntimeError(out, errObj)
+		return nil, false
+	}
+	return result, true
+}
+
+func newImporter(engine Engine, dir string) *evaluator.Importer {
+	var importer *evaluator.Importer
+	if engine == VM {
+		importer = vm.NewImporter(evaluator.SearchPath())
+	} else {
+		importer = evaluator.NewImporter(evaluator.SearchPath())
+	}
+	importer.BaseDir = dir
+	return importer
+}
+
+func newRunner(options Options) runner {
+	importer := newImporter(options.Engine, options.Dir)
+	if options.Engine == VM {
+		return newVMRunner(importer, options.Trace)
+	}
+
+	env := object.NewEnvironment()
+	env.SetLoader(importer)
+	return func(program ast.Node) (object.Object, *object.Error) {
+		evaluated := evaluator.Eval(program, env)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			return nil, errObj
+		}
+		return evaluated, nil
+	}
+}
+
+/*
+  The symbol table, constants and globals carry over from one run to the
+  next. Compile errors are reported like runtime errors, the evaluator
+  finds the same problems only when it runs the code
+*/
+func newVMRunner(importer *evaluator.Importer, trace io.Writer) runner {
+	symbolTable := compiler.NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+
+	return func(program ast.Node) (object.Object, *object.Error) {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(program); err != nil {
+			return nil, &object.Error{Message: err.Error()}
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := vm.NewWithGlobalsStore(bytecode, globals)
+		machine.SetLoader(importer)
+		if trace != nil {
+			machine.SetTrace(trace)
+		}
+		if err := machine.Run(); err != nil {
+			return nil, &object.Error{Message: err.Error()}
+		}
+		return machine.Result(), nil
+	}
+}
+
+func printParserErrors(out io.Writer, errors parser.ErrorList) {
+	msgs := []string{}
+	for _, err := range errors {
+		msgs = append(msgs, err.Error())
+	}
+	printMonkeyBusiness(out, "parser errors", msgs)
+}
+
+func printRuntimeError(out io.Writer, err *object.Error) {
+	printMonkeyBusiness(out, "runtime error", []string{err.Message})
+}
+
+func printMonkeyBusiness(out io.Writer, kind string, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
+	io.WriteString(out, " "+kind+":\n")
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
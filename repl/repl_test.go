@@ -0,0 +1,95 @@
+package repl
+
+import (
+	"bytes"
+	"gomonkey/optimizer"
+	"strings"
+	"testing"
+)
+
+func TestStartKeepsStateAcrossLines(t *testing.T) {
+	input := "let x = 5;\nlet add = fn(a, b) { a + b };\nadd(x, 10)\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := PROMPT + PROMPT + PROMPT + "15\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q [actual=%q]", expected, out.String())
+	}
+}
+
+func TestStartSurvivesErrors(t *testing.T) {
+	input := "let x = ;\nx + true\nlet x = 2;\nx\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	output := out.String()
+	if !strings.Contains(output, " parser errors:\n") {
+		t.Errorf("parser error banner missing [actual=%q]", output)
+	}
+	if !strings.Contains(output, " runtime error:\n\tidentifier not found: x\n") {
+		t.Errorf("runtime error banner missing [actual=%q]", output)
+	}
+	if !strings.HasSuffix(output, PROMPT+"2\n"+PROMPT) {
+		t.Errorf("session did not continue after errors [actual=%q]", output)
+	}
+}
+
+func TestStartKeepsMacrosAcrossLines(t *testing.T) {
+	input := "let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };\n" +
+		"unless(1 > 2, 10, 20)\n" +
+		"let bad = macro() { 1 };\nbad()\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	output := out.String()
+	if !strings.HasPrefix(output, PROMPT+PROMPT+"10\n") {
+		t.Errorf("macro was not expanded [actual=%q]", output)
+	}
+	if !strings.Contains(output, " runtime error:\n\tmacro bad must return a quote, got INTEGER\n") {
+		t.Errorf("macro error banner missing [actual=%q]", output)
+	}
+}
+
+func TestStartWithVM(t *testing.T) {
+	input := "let x = 5;\nlet add = fn(a, b) { a + b };\nadd(x, 10)\nx = y\nlet y = 1;\nx += y\n"
+	var out bytes.Buffer
+	StartWithEngine(strings.NewReader(input), &out, VM)
+
+	output := out.String()
+	if !strings.HasPrefix(output, PROMPT+PROMPT+PROMPT+"15\n") {
+		t.Errorf("state was not kept across lines [actual=%q]", output)
+	}
+	if !strings.Contains(output, " runtime error:\n\tidentifier not found: y\n") {
+		t.Errorf("runtime error banner missing [actual=%q]", output)
+	}
+	if !strings.HasSuffix(output, PROMPT+PROMPT+"6\n"+PROMPT) {
+		t.Errorf("session did not continue after errors [actual=%q]", output)
+	}
+}
+
+func TestRunProgramOptimized(t *testing.T) {
+	input := "let f = fn(x) { if (true) { return x * (2 + 3); } puts(1) };\nf(2) / (1 - 1)\n"
+	for _, engine := range []Engine{EVAL, VM} {
+		var out bytes.Buffer
+		ok := RunProgram(input, &out, Options{Engine: engine, Optimize: optimizer.All})
+
+		output := out.String()
+		if ok || !strings.Contains(output, " runtime error:\n\tdivision by zero: 10 / 0\n") {
+			t.Errorf("%s: runtime error banner missing [actual=%q]", engine, output)
+		}
+	}
+}
+
+func TestStartOptimized(t *testing.T) {
+	input := "let f = fn() { 1 + 2 * 3 };\nf\nf()\n"
+	for _, engine := range []Engine{EVAL, VM} {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(input), &out, Options{Engine: engine, Optimize: optimizer.All})
+
+		output := out.String()
+		if strings.Contains(output, "2 * 3") || !strings.HasSuffix(output, PROMPT+"7\n"+PROMPT) {
+			t.Errorf("%s: lines were not optimized [actual=%q]", engine, output)
+		}
+	}
+}
@@ -1,20 +1,75 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
     Type    TokenType
     Literal string
+    Pos     Position
+    Trivia  *Trivia     // only set when the lexer keeps comments
+}
+
+/*
+  Comments around a token. Leading are the comments between the previous
+  token and this one, Trailing are the ones after this token that start
+  on the same line it ends on
+*/
+type Trivia struct {
+    Leading     []Comment
+    Trailing    []Comment
+}
+
+// Text is the comment as written, markers included
+// (eg. "// note" or "/* note */")
+type Comment struct {
+    Text    string
+    Pos     Position
+}
+
+/*
+  Where a token starts in the source. Offset counts bytes and RuneOffset
+  counts characters from the start of the input, both 0-based. Line and
+  Column are 1-based, Column counts characters. A zero Position means the
+  location is unknown (eg. tokens built by hand in tests)
+*/
+type Position struct {
+    Offset      int
+    RuneOffset  int
+    Line        int
+    Column      int
+}
+
+func (p Position) IsValid() bool {
+    return p.Line > 0
+}
+
+func (p Position) String() string {
+    if !p.IsValid() {
+        return "-"
+    }
+    return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
-    "if"     : IF,
-    "else"   : ELSE,
-    "return" : RET,
-    "fn"     : FNCT,
-    "let"    : LET,
-    "true"   : TRUE,
-    "false"  : FALS,
+    "if"       : IF,
+    "else"     : ELSE,
+    "return"   : RET,
+    "fn"       : FNCT,
+    "let"      : LET,
+    "true"     : TRUE,
+    "false"    : FALS,
+    "while"    : WHILE,
+    "for"      : FOR,
+    "in"       : IN,
+    "break"    : BREAK,
+    "continue" : CONT,
+    "match"    : MATCH,
+    "macro"    : MACRO,
+    "import"   : IMPORT,
+    "export"   : EXPORT,
+    "as"       : AS,
 }
 
 func IdentifierLookup(identifier string) TokenType{
@@ -33,29 +88,62 @@ const (
     IF      = "if"
     ELSE    = "else"
     RET     = "ret"
+    WHILE   = "while"
+    FOR     = "for"
+    IN      = "in"
+    BREAK   = "break"
+    CONT    = "continue"
+    MATCH   = "match"
+    MACRO   = "macro"
+    IMPORT  = "import"
+    EXPORT  = "export"
+    AS      = "as"
     EQ      = "=="
     NEQ     = "!="
+    LTE     = "<="
+    GTE     = ">="
+    AND     = "&&"
+    OR      = "||"
+    POW     = "**"
 
     //Identifiers + Literals
     IDN     = "identifier"
     INT     = "int"
+    FLOAT   = "float"
+    STRING  = "string"
 
     //Delimeters
     COM     = ","
     SCLN    = ";"
+    CLN     = ":"
+    DOT     = "."
+    ARROW   = "=>"
 
     LPAR    = "("
     RPAR    = ")"
     LBRA    = "{"
     RBRA    = "}"
+    LBRK    = "["
+    RBRK    = "]"
     
     //Operators
     AGMT    = "="
+    PLUSEQ  = "+="
+    MINSEQ  = "-="
+    ASTKEQ  = "*="
+    DIVEQ   = "/="
     PLUS    = "+"
     DIV     = "/"
     MINS    = "-"
     BANG    = "!"
     ASTK    = "*"
+    MOD     = "%"
+    BAND    = "&"
+    BOR     = "|"
+    XOR     = "^"
+    TILDE   = "~"
+    SHL     = "<<"
+    SHR     = ">>"
     LT      = "<"
     GT      = ">"
 
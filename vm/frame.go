@@ -0,0 +1,24 @@
+package vm
+
+import (
+	"gomonkey/code"
+	"gomonkey/object"
+)
+
+/*
+  A call in progress. The locals of the call live on the stack from
+  basePointer on, the arguments being the first of them
+*/
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"gomonkey/ast"
+	"gomonkey/compiler"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+)
+
+/*
+  An importer whose modules are compiled and run by the VM, so what they
+  export are closures like the ones of the importing program. The
+  search rules and the module cache are the evaluator's
+*/
+func NewImporter(searchPath []string) *evaluator.Importer {
+	importer := evaluator.NewImporter(searchPath)
+	importer.Run = runModule
+	return importer
+}
+
+/*
+  Each module has its own globals, the exports are read from them. An
+  export whose 'let' never ran, eg. after an early return, is missing
+  like in the evaluator
+*/
+func runModule(code *ast.Code, exports []string, importer *evaluator.Importer) (map[string]object.Object, *object.Error) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(code); err != nil {
+		return nil, &object.Error{Message: err.Error()}
+	}
+
+	machine := New(comp.Bytecode())
+	machine.SetLoader(importer)
+	if err := machine.Run(); err != nil {
+		return nil, &object.Error{Message: err.Error()}
+	}
+
+	values := map[string]object.Object{}
+	for _, name := range exports {
+		symbol, ok := symbolTable.Resolve(name)
+		if !ok || symbol.Scope != compiler.GlobalScope {
+			continue
+		}
+		if value := machine.globals[symbol.Index]; value != nil {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,748 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"gomonkey/code"
+	"gomonkey/compiler"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"io"
+	"strings"
+)
+
+const (
+	GlobalsSize  = 65536
+	StackSize    = 2048    // initial size, the stack grows as needed
+	MaxStackSize = 1 << 22 // slots
+	MaxFrames    = 1 << 20
+)
+
+/*
+  The VM shares its operators, booleans and null with the evaluator, which
+  is what makes both backends give the same results
+*/
+var (
+	True  = evaluator.TRUE
+	False = evaluator.FALSE
+	Null  = evaluator.NULL
+)
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShl:          "<<",
+	code.OpShr:          ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpMinus:        "-",
+	code.OpBang:         "!",
+	code.OpBitNot:       "~",
+}
+
+type VM struct {
+	program *object.Program // of the function running in the current frame
+	globals []object.Object // of the top level
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top is stack[sp-1]
+
+	frames []*Frame
+
+	loader object.ModuleLoader
+	result object.Object
+
+	trace io.Writer
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+/* Runs against existing globals, the REPL keeps them from line to line */
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	program := &object.Program{
+		Constants:   bytecode.Constants,
+		Globals:     globals,
+		GlobalNames: bytecode.GlobalNames,
+	}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	mainClosure := &object.Closure{Fn: mainFn, Program: program}
+
+	return &VM{
+		program: program,
+		globals: globals,
+		stack:   make([]object.Object, StackSize),
+		frames:  []*Frame{NewFrame(mainClosure, 0)},
+	}
+}
+
+/* Resolves the modules named by import statements */
+func (vm *VM) SetLoader(loader object.ModuleLoader) {
+	vm.loader = loader
+}
+
+/*
+  Logs every instruction to w before it runs, together with the function
+  it belongs to and the value on top of the stack
+*/
+func (vm *VM) SetTrace(w io.Writer) {
+	vm.trace = w
+}
+
+/*
+  The value the program returned, the value of its last statement unless
+  it returned early. nil when the program has no value, eg. because it
+  ends with a let statement
+*/
+func (vm *VM) Result() object.Object {
+	return vm.result
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if len(vm.frames) >= MaxFrames {
+		return errors.New("stack overflow")
+	}
+	vm.frames = append(vm.frames, f)
+	vm.program = f.cl.Program
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	f := vm.currentFrame()
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	if len(vm.frames) > 0 {
+		vm.program = vm.currentFrame().cl.Program
+	}
+	return f
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Main loop --------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/*
+  Runs until the top level returns or an error stops the program. Loading
+  a precompiled file can't catch every mistake in it, eg. popping an
+  empty stack, those stop the program with an error too
+*/
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid bytecode: %v", r)
+		}
+	}()
+
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+		if vm.trace != nil {
+			vm.traceInstruction(frame)
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if err := vm.push(vm.program.Constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpLessEqual,
+			code.OpGreaterThan, code.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			if err := vm.pushResult(evaluator.Infix(operators[op], left, right)); err != nil {
+				return err
+			}
+
+		case code.OpMinus, code.OpBang, code.OpBitNot:
+			right := vm.pop()
+			if err := vm.pushResult(evaluator.Prefix(operators[op], right)); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpDup:
+			if err := vm.push(vm.stack[vm.sp-1]); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		// Bindings
+		case code.OpGetGlobal:
+			index := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			value := vm.program.Globals[index]
+			if err := vm.pushVariable(value, vm.program.GlobalNames[index]); err != nil {
+				return err
+			}
+
+		case code.OpSetGlobal:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.program.Globals[index] = vm.pop()
+
+		case code.OpAssignGlobal:
+			index := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if vm.program.Globals[index] == nil {
+				return fmt.Errorf("assignment to undeclared identifier: %s", vm.program.GlobalNames[index])
+			}
+			vm.program.Globals[index] = vm.pop()
+
+		case code.OpGetLocal:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			value := vm.local(frame, index)
+			if err := vm.pushVariable(value, frame.cl.Fn.Locals[index]); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			slot := &vm.stack[frame.basePointer+index]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetFree:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			value := frame.cl.Free[index].(*cell).value
+			if err := vm.pushVariable(value, frame.cl.Fn.Captures[index].Name); err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			index := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			frame.cl.Free[index].(*cell).value = vm.pop()
+
+		case code.OpGetBuiltin:
+			index := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			if err := vm.push(object.Builtins[index].Builtin); err != nil {
+				return err
+			}
+
+		// Data structures
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			if err := vm.push(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp -= numElements
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			if err := vm.pushResult(evaluator.Index(left, index)); err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			operator := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			if err := vm.pushResult(vm.setIndex(left, index, value, operator)); err != nil {
+				return err
+			}
+
+		case code.OpMember:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			name := vm.program.Constants[nameIndex].(*object.String).Value
+			if err := vm.pushResult(evaluator.Member(vm.pop(), name)); err != nil {
+				return err
+			}
+
+		// Functions
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			if err := vm.call(numArgs); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if done := vm.returnFromFrame(returnValue); done {
+				return nil
+			}
+
+		case code.OpReturn:
+			if done := vm.returnFromFrame(nil); done {
+				return nil
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if err := vm.pushClosure(int(constIndex)); err != nil {
+				return err
+			}
+
+		// Loops
+		case code.OpIter:
+			items, errObj := evaluator.IterationItems(vm.pop())
+			if errObj != nil {
+				return errors.New(errObj.Message)
+			}
+			if err := vm.push(&iterator{items: items}); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			iter, ok := vm.stack[vm.sp-1].(*iterator)
+			if !ok {
+				return fmt.Errorf("OpIterNext needs an iterator on the stack, got %s", vm.stack[vm.sp-1].Type())
+			}
+			if iter.next >= len(iter.items) {
+				if err := vm.push(False); err != nil {
+					return err
+				}
+				break
+			}
+			iter.next++
+			if err := vm.push(iter.items[iter.next-1]); err != nil {
+				return err
+			}
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpLoop:
+			if err := vm.push(&iterator{}); err != nil {
+				return err
+			}
+
+		case code.OpUnwind:
+			if err := vm.unwind(frame); err != nil {
+				return err
+			}
+
+		// Match patterns
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			array, ok := vm.pop().(*object.Array)
+			if err := vm.pushBool(ok && len(array.Elements) == length); err != nil {
+				return err
+			}
+
+		case code.OpMatchHash:
+			_, ok := vm.pop().(*object.Hash)
+			if err := vm.pushBool(ok); err != nil {
+				return err
+			}
+
+		case code.OpMatchKey:
+			value := vm.pop()
+			below := vm.pop()
+			hash, ok := below.(*object.Hash)
+			if !ok {
+				return fmt.Errorf("OpMatchKey needs a hash below the key, got %s", below.Type())
+			}
+			key, ok := value.(object.Hashable)
+			if !ok {
+				return fmt.Errorf("unusable as hash key: %s", value.Type())
+			}
+			_, found := hash.Get(key)
+			if err := vm.pushBool(found); err != nil {
+				return err
+			}
+
+		case code.OpMatchEqual:
+			literal := vm.pop()
+			value := vm.pop()
+			if err := vm.pushBool(evaluator.Infix("==", literal, value) == True); err != nil {
+				return err
+			}
+
+		case code.OpQuote:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numValues := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			quote := vm.program.Constants[constIndex].(*object.Quote)
+			values := make([]object.Object, numValues)
+			copy(values, vm.stack[vm.sp-numValues:vm.sp])
+			vm.sp -= numValues
+			if err := vm.pushResult(evaluator.QuoteWith(quote.Node, values)); err != nil {
+				return err
+			}
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			path := vm.program.Constants[constIndex].(*object.String).Value
+			if vm.loader == nil {
+				return fmt.Errorf("cannot import %q: no module loader configured", path)
+			}
+			if err := vm.pushResult(vm.loader.Import(path)); err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("opcode %s not supported", def.Name)
+		}
+	}
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Stack ------------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+/* Pushes the result of an operation shared with the evaluator */
+func (vm *VM) pushResult(result object.Object) error {
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) pushBool(value bool) error {
+	if value {
+		return vm.push(True)
+	}
+	return vm.push(False)
+}
+
+/*
+  A slot without a value belongs to a name whose 'let' hasn't run yet.
+  Like in the evaluator the name may still be a builtin
+*/
+func (vm *VM) pushVariable(value object.Object, name string) error {
+	if value == nil {
+		builtin := object.GetBuiltinByName(name)
+		if builtin == nil {
+			return fmt.Errorf("identifier not found: %s", name)
+		}
+		value = builtin
+	}
+	return vm.push(value)
+}
+
+/*
+  The value of a local slot, or while the slot is unbound the value of
+  the outer variable it shadows. nil when neither is bound
+*/
+func (vm *VM) local(frame *Frame, index int) object.Object {
+	value := vm.stack[frame.basePointer+index]
+	if c, ok := value.(*cell); ok {
+		value = c.value
+	}
+	if value != nil {
+		return value
+	}
+
+	for _, fallback := range frame.cl.Fn.Fallbacks {
+		if fallback.Local != index {
+			continue
+		}
+		switch fallback.Scope {
+		case "GLOBAL":
+			return vm.program.Globals[fallback.Index]
+		case "LOCAL":
+			return vm.local(frame, fallback.Index)
+		case "FREE":
+			return frame.cl.Free[fallback.Index].(*cell).value
+		}
+	}
+	return nil
+}
+
+/* Long values are cut so each instruction stays on one line */
+const traceValueWidth = 40
+
+func (vm *VM) traceInstruction(frame *Frame) {
+	name := "main"
+	if len(vm.frames) > 1 {
+		name = compiler.FunctionName(frame.cl.Fn)
+	}
+	text, _ := compiler.FormatInstruction(vm.program, frame.cl.Fn, frame.ip)
+
+	top := "-"
+	if vm.sp > 0 {
+		top = strings.ReplaceAll(vm.stack[vm.sp-1].Inspect(), "\n", " ")
+		if len(top) > traceValueWidth {
+			top = top[:traceValueWidth-3] + "..."
+		}
+	}
+	fmt.Fprintf(vm.trace, "%-12s %-48s [top: %s]\n", name, text, top)
+}
+
+func (vm *VM) growStack(size int) error {
+	if size > MaxStackSize {
+		return errors.New("stack overflow")
+	}
+	newSize := 2 * len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	return nil
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Operations -------------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* Keys and values alternate in stack[start:end] */
+func (vm *VM) buildHash(start, end int) (object.Object, error) {
+	hash := object.NewHash()
+	for i := start; i < end; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", vm.stack[i].Type())
+		}
+		hash.Set(key, vm.stack[i+1])
+	}
+	return hash, nil
+}
+
+/* operator is the opcode of a compound assignment, 0 for a plain one */
+func (vm *VM) setIndex(left, index, value object.Object, operator code.Opcode) object.Object {
+	if operator != 0 {
+		current := evaluator.Index(left, index)
+		if _, ok := current.(*object.Error); ok {
+			return current
+		}
+		value = evaluator.Infix(operators[operator], current, value)
+		if _, ok := value.(*object.Error); ok {
+			return value
+		}
+	}
+	return evaluator.SetIndex(left, index, value)
+}
+
+/* The callee sits below its arguments on the stack */
+func (vm *VM) call(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+/* The locals that are not arguments start out empty */
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: expected %d, got %d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	basePointer := vm.sp - numArgs
+	top := basePointer + cl.Fn.NumLocals
+	if top > len(vm.stack) {
+		if err := vm.growStack(top); err != nil {
+			return err
+		}
+	}
+	for i := vm.sp; i < top; i++ {
+		vm.stack[i] = nil
+	}
+
+	if err := vm.pushFrame(NewFrame(cl, basePointer)); err != nil {
+		return err
+	}
+	vm.sp = top
+	return nil
+}
+
+/* A builtin that returns nothing gives null, like in the evaluator */
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if result == nil {
+		result = Null
+	}
+	return vm.pushResult(result)
+}
+
+/*
+  Returns true when the top level returned, which ends the program. A
+  function that returns no value gives null to its caller
+*/
+func (vm *VM) returnFromFrame(value object.Object) bool {
+	frame := vm.popFrame()
+	if len(vm.frames) == 0 {
+		vm.result = value
+		return true
+	}
+
+	if value == nil {
+		value = Null
+	}
+	vm.sp = frame.basePointer - 1
+	vm.stack[vm.sp] = value
+	vm.sp++
+	return false
+}
+
+/*
+  Captured locals are moved into a cell the first time a closure captures
+  them, from then on the frame and every closure share the cell. That
+  gives the evaluator's semantics where closures see later assignments
+*/
+func (vm *VM) pushClosure(constIndex int) error {
+	fn, ok := vm.program.Constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.program.Constants[constIndex])
+	}
+
+	frame := vm.currentFrame()
+	free := make([]object.Object, len(fn.Captures))
+	for i, capture := range fn.Captures {
+		if !capture.Local {
+			free[i] = frame.cl.Free[capture.Index]
+			continue
+		}
+		slot := &vm.stack[frame.basePointer+capture.Index]
+		c, ok := (*slot).(*cell)
+		if !ok {
+			c = &cell{value: *slot}
+			*slot = c
+		}
+		free[i] = c
+	}
+
+	return vm.push(&object.Closure{Fn: fn, Free: free, Program: vm.program})
+}
+
+/*  ----------------------------------------------------------- */
+/*  --- Internal values --------------------------------------- */
+/*  ----------------------------------------------------------- */
+
+/* A variable shared between a frame and the closures that captured it */
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return "cell" }
+
+/*
+  Pops the operands a break or continue leaves behind, down to the
+  iterator of the innermost loop. The locals of the frame are never
+  popped, there is no loop to unwind to below them
+*/
+func (vm *VM) unwind(frame *Frame) error {
+	bottom := frame.basePointer + frame.cl.Fn.NumLocals
+	for vm.sp > bottom {
+		if _, ok := vm.stack[vm.sp-1].(*iterator); ok {
+			return nil
+		}
+		vm.pop()
+	}
+	return errors.New("OpUnwind outside of a loop")
+}
+
+/* The items a for loop walks, a while loop keeps an empty one as its marker */
+type iterator struct {
+	items []object.Object
+	next  int
+}
+
+func (i *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (i *iterator) Inspect() string         { return "iterator" }
@@ -0,0 +1,369 @@
+package vm
+
+import (
+	"bytes"
+	"gomonkey/code"
+	"gomonkey/compiler"
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+  Every program is run by the evaluator and by the VM, both must print the
+  same result or fail with the same error
+*/
+func TestSameResultsAsEvaluator(t *testing.T) {
+	inputs := []string{
+		// operators
+		"1 + 2 * 3 - 4 / 2", "7 % 3 + 2 ** 10", "1 + 0.5", "5 / 2.0", "7 & 3 | 8 ^ 1",
+		"1 << 4 >> 2", "~5", "-(3)", "!true", "!!5", "1 < 2 == true", "2.5 >= 2",
+		`"a" + "b"`, `"a" < "b"`, "1 / 0", `"a" - "b"`, "1 + true", "-true",
+		"true && 0", "false || 2", "1 && x", "false && x",
+		// bindings and scopes
+		"let x = 1; x", "let x = 1;", "x", "let a = 5; let b = a; a + b",
+		"let i = 0; while (i < 10) { let i = i + 1; }; i",
+		"if (true) { let y = 3; }; y", "for (x in [1, 2, 3]) { }; x",
+		"let f = fn() { let y = 1; }; f(); y",
+		"len([1, 2])", "let len = fn(x) { 42 }; len([1])", "len = 1", "puts",
+		"y = 1", "x += 1", "len += 1", "let f = fn() { nope = 1 }; 5", "let f = fn() { nope += 1 }; f()",
+		"let f = fn() { x = 1 }; let x = 0; f(); x", "let f = fn() { len = 1 }; let len = 5; f(); len",
+		"let f = fn() { len = 1 }; f()", "y = 1; let y = 2; y",
+		// conditionals
+		"if (1 < 2) { 10 } else { 20 }", "if (false) { 1 }", "if (false) { 1 } else if (true) { 2 }",
+		"if (null) { 1 } else { 2 }",
+		// functions and closures
+		"let add = fn(a, b) { a + b }; add(1, 2)", "fn(x) { x * 2 }", "let f = fn(x) { x }; f",
+		"let f = fn(n) { if (n < 2) { return n; } f(n - 1) + f(n - 2) }; f(15)",
+		"let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)",
+		"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",
+		"let x = 1; let f = fn() { x }; let x = 2; f()",
+		"let f = fn() { g() }; let g = fn() { 5 }; f()",
+		"let f = fn() { g() }; f()",
+		"let x = 1; let f = fn() { let y = x; let x = 2; [y, x] }; f()",
+		"let f = fn(x) { fn() { let x = x + 1; x } }; f(1)()",
+		"let f = fn() { let a = 1; let g = fn() { a = a + 10; }; g(); a }; f()",
+		"let f = fn(a) { a }; f()", "5(1)", "fn(a, a) { a }(1, 2)", "fn(a, b, a) { [a, b] }(1, 2, 3)",
+		"let f = fn(x) { let g = fn() { x }; let x = 9; g() }; f(1)",
+		"let f = fn() {}; f()", "let f = fn() {}; f() + 1", "-fn() {}()", "[fn() {}()]",
+		"true && fn() {}()", "if (true) { } + 1", "let a = if (true) { let z = 1; }; a",
+		// arrays, hashes, strings
+		"[1, 2 + 3, [4]]", "[1, 2][5]", "[1, 2][-1]", `{"a": 1, true: 2}["a"]`, "{[1]: 2}",
+		`{"b": 1, "a": 2}`, `"héllo"[1]`, `let h = {}; h["x"] = 1; h["x"] += 2; h`,
+		"let a = [1, 2]; a[0] *= 5; a", "let a = [1]; a[3] = 1",
+		`first(rest(push([1, 2], 3)))`, `len("abc", 1)`, `type(1.5)`,
+		// loops
+		"let s = 0; for (x in [1, 2, 3]) { if (x == 2) { continue; } s += x; }; s",
+		"let s = 0; let i = 0; while (true) { i += 1; if (i > 5) { break; } s += i; }; s",
+		`let k = ""; for (c in {"x": 1, "y": 2}) { k = k + c; }; k`,
+		"for (x in 1) { }", "while (true) { break; }",
+		"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 100; } } }; f()",
+		"let fs = []; for (i in [1, 2, 3]) { let fs = push(fs, fn() { i }); }; fs[0]()",
+		"let s = []; for (x in [1, 2, 3]) { s = push(s, if (x == 2) { continue } else { x }) }; s",
+		"let s = 0; for (x in [1, 2, 3]) { s = s + [100, if (x == 2) { break } else { x }][1] }; s",
+		"let s = 0; let i = 0; while (i < 5) { i += 1; s += -(if (i == 3) { continue } else { i }) }; s",
+		`let n = 0; for (x in [1, 2]) { let h = {if (x == 1) { continue } else { "k" }: x}; n += h["k"] }; n`,
+		"let s = 0; for (x in [1, 2, 3]) { while (if (x == 2) { break } else { false }) { }; s += x }; s",
+		"let s = 0; for (x in [1, 2, 3]) { s += match (x) { 2 => if (true) { continue } else { 0 }, _ => x } }; s",
+		"let f = fn(x) { let y = if (x) { return 1 } else { 2 }; y * 10 }; [f(true), f(false)]",
+		// match
+		`match ([1, [2, 3]]) { [1, [_, c]] => c, _ => 0 }`,
+		`match ({"x": 1, "y": 2}) { {"x": x, "y": y} => x + y, _ => 0 }`,
+		`match ("s") { [a] => 1, {"a": a} => 2, _ => 3 }`, `match (2.0) { 2 => "two", _ => 0 }`,
+		`let a = 1; match ([5]) { [a] => a, _ => 0 }; a`, `match (x) { _ => 1 }`,
+		`let f = fn(v) { match (v) { n => fn() { n * 2 } } }; f(4)()`,
+		// quote and macros
+		"quote(1 + 2)", "let x = 8; quote(unquote(x) + unquote(2 * 3))",
+		"let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(1 > 2, 10, 20)",
+		"let f = fn() { macro(x) { x } }; f()",
+		"quote(unquote(unquote(1)))", "quote(unquote(unquote(unquote(2)) + 1) * unquote(3))",
+		"quote(unquote(unquote(quote(1 + 2)) * 2))", "quote(unquote(unquote(fn() { 1 })))",
+		`quote(unquote([unquote("a"), 1]))`, "let y = 5; let x = quote(y); quote(unquote(unquote(x)))",
+		"let f = fn() { let y = 5; let x = quote(y); quote(unquote(unquote(x))) }; f()",
+		"let f = fn() { quote(unquote(unquote(1))) }; 5", "quote(unquote(fn() { unquote(1) }))",
+		// members
+		"let x = 1; x.y",
+	}
+
+	for _, input := range inputs {
+		expected := runEvaluator(input)
+		actual := runVM(t, input, nil)
+		if actual != expected {
+			t.Errorf("wrong result for %s. expected=%q [actual=%q]", input, expected, actual)
+		}
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100000)"
+	if actual := runVM(t, input, nil); actual != "100000" {
+		t.Errorf("wrong result. expected=%q [actual=%q]", "100000", actual)
+	}
+
+	input = "let f = fn(n) { f(n + 1) }; f(0)"
+	if actual := runVM(t, input, nil); actual != "error: stack overflow" {
+		t.Errorf("wrong result. expected=%q [actual=%q]", "error: stack overflow", actual)
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"math.monkey": `
+			let square = fn(x) { x * x };
+			export let cube = fn(x) { square(x) * x };
+			export let answer = 42;`,
+		"twice.monkey": `
+			import "math.monkey" as m;
+			export let sixth = fn(x) { m.cube(x) * m.cube(x) };`,
+		"failing.monkey": `export let x = 1 + true;`,
+		"early.monkey": `export let x = 1; return 0; export let y = 2;`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "math.monkey" as m; m.answer + m.cube(2)`, "50"},
+		{`import "twice.monkey" as t; t.sixth(2)`, "64"},
+		{`import "math.monkey" as m; m.square(3)`, `error: module "math.monkey" does not export square`},
+		{`import "failing.monkey" as f; 1`, `error: in module "failing.monkey": type mismatch: INTEGER + BOOLEAN`},
+		{`import "early.monkey" as e; e.x`, "1"},
+		{`import "early.monkey" as e; puts(e.y)`, `error: module "early.monkey" does not export y`},
+	}
+	for _, tt := range tests {
+		importer := NewImporter(nil)
+		importer.BaseDir = dir
+		if actual := runVM(t, tt.input, importer); actual != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q [actual=%q]", tt.input, tt.expected, actual)
+		}
+	}
+
+	input := `import "math.monkey" as m; 1`
+	if actual := runVM(t, input, nil); actual != `error: cannot import "math.monkey": no module loader configured` {
+		t.Errorf("import without a loader should fail [actual=%q]", actual)
+	}
+}
+
+/* The REPL runs each line in a new VM over the same globals */
+func TestGlobalsStore(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	tests := []struct {
+		lines    []string
+		expected string
+	}{
+		{[]string{"let x = 5;", "let f = fn(y) { x * y };", "f(3)"}, "15"},
+		// the function assigns to a global defined by a later line
+		{[]string{"let g = fn() { z = 1 };", "let z = 0;", "g(); z"}, "1"},
+	}
+	for _, tt := range tests {
+		var result object.Object
+		for _, line := range tt.lines {
+			comp := compiler.NewWithState(symbolTable, constants)
+			if err := comp.Compile(parser.New(lexer.New(line)).ParseCode()); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+			constants = bytecode.Constants
+
+			machine := NewWithGlobalsStore(bytecode, globals)
+			if err := machine.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			result = machine.Result()
+		}
+		if result == nil || result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q [actual=%v]", tt.lines, tt.expected, result)
+		}
+	}
+}
+
+/* The program's result as the REPL would print it */
+func runEvaluator(input string) string {
+	code := parser.New(lexer.New(input)).ParseCode()
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(code, macroEnv)
+	expanded, errObj := evaluator.ExpandMacros(code, macroEnv)
+	if errObj != nil {
+		return "error: " + errObj.Message
+	}
+
+	result := evaluator.Eval(expanded, object.NewEnvironment())
+	if errObj, ok := result.(*object.Error); ok {
+		return "error: " + errObj.Message
+	}
+	if result == nil {
+		return ""
+	}
+	return result.Inspect()
+}
+
+func runVM(t *testing.T, input string, importer *evaluator.Importer) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	code := p.ParseCode()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %s: %s", input, p.Errors())
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(code, macroEnv)
+	expanded, errObj := evaluator.ExpandMacros(code, macroEnv)
+	if errObj != nil {
+		return "error: " + errObj.Message
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(expanded); err != nil {
+		return "error: " + err.Error()
+	}
+	machine := New(comp.Bytecode())
+	if importer != nil {
+		machine.SetLoader(importer)
+	}
+	if err := machine.Run(); err != nil {
+		return "error: " + err.Error()
+	}
+	if machine.Result() == nil {
+		return ""
+	}
+	return machine.Result().Inspect()
+}
+
+/* A program loaded from its precompiled form runs like the compiled one */
+func TestPrecompiledBytecode(t *testing.T) {
+	input := `let counter = fn() { let n = 0; fn() { n += 1 } };
+let c = counter(); c(); c();
+[c(), 2.5, "s", match ([1, 2]) { [a, b] => a + b, _ => 0 }]`
+	comp := compiler.New()
+	if err := comp.Compile(parser.New(lexer.New(input)).ParseCode()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+
+	bytecode := &compiler.Bytecode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+	machine := New(bytecode)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	expected := `[3, 2.5, s, 3]`
+	if machine.Result().Inspect() != expected {
+		t.Errorf("wrong result. expected=%q [actual=%q]", expected, machine.Result().Inspect())
+	}
+}
+
+/* A file that loads but is still wrong stops the VM with an error */
+func TestInvalidPrecompiledBytecode(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: append(code.Make(code.OpPop), code.Make(code.OpReturn)...),
+	}
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %s", err)
+	}
+	loaded := &compiler.Bytecode{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %s", err)
+	}
+
+	err = New(loaded).Run()
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid bytecode: ") {
+		t.Errorf("wrong error [actual=%v]", err)
+	}
+}
+
+/* Loop and match instructions out of place fail with an error instead of a panic */
+func TestMisplacedLoopInstructions(t *testing.T) {
+	tests := []struct {
+		instructions []code.Instructions
+		expected     string
+	}{
+		{
+			[]code.Instructions{code.Make(code.OpTrue), code.Make(code.OpIterNext)},
+			"OpIterNext needs an iterator on the stack, got BOOLEAN",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpTrue), code.Make(code.OpUnwind)},
+			"OpUnwind outside of a loop",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpHash, 0), code.Make(code.OpHash, 0), code.Make(code.OpMatchKey)},
+			"unusable as hash key: HASH",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpTrue), code.Make(code.OpTrue), code.Make(code.OpMatchKey)},
+			"OpMatchKey needs a hash below the key, got BOOLEAN",
+		},
+	}
+	for _, tt := range tests {
+		instructions := code.Instructions{}
+		for _, ins := range tt.instructions {
+			instructions = append(instructions, ins...)
+		}
+		err := New(&compiler.Bytecode{Instructions: instructions}).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q [actual=%v]", tt.expected, err)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	input := "let f = fn(x) { x * 2 };\nf(3)"
+	comp := compiler.New()
+	if err := comp.Compile(parser.New(lexer.New(input)).ParseCode()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var trace bytes.Buffer
+	machine := New(comp.Bytecode())
+	machine.SetTrace(&trace)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	expected := []string{
+		"main         0000    1 OpClosure 1",
+		"main         0003    1 OpSetGlobal 0",
+		"main         0006    2 OpGetGlobal 0",
+		"main         0009    2 OpConstant 2",
+		"main         0012    2 OpCall 1",
+		"fn(x)        0000    1 OpGetLocal 0",
+		"fn(x)        0002    1 OpConstant 0",
+		"fn(x)        0005    1 OpMul",
+		"fn(x)        0006    1 OpReturnValue",
+		"main         0014    2 OpReturnValue",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of traced instructions. expected=%d [actual=%q]", len(expected), trace.String())
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("wrong trace line %d. expected=%q [actual=%q]", i, prefix, lines[i])
+		}
+	}
+	// the top of the stack before the multiplication and before returning
+	if !strings.HasSuffix(lines[7], "[top: 2]") || !strings.HasSuffix(lines[8], "[top: 6]") {
+		t.Errorf("wrong top of the stack [actual=%q, %q]", lines[7], lines[8])
+	}
+}